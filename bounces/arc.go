@@ -0,0 +1,86 @@
+package bounces
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// maxTurn is the largest angle a curling object turns before its curvature
+// is updated to match the lower speed, minLeave the smallest angle it leaves
+// an obstacle with.
+const maxTurn = 0.2
+const minLeave = maxTurn / 4
+
+type arcObstacle interface {
+	ArcDistToColl(x, y, vx, vy, k, r float64) (float64, bool)
+}
+
+// curl returns the signed curl to use for one trajectory.
+func (inp Input) curl(r *rand.Rand) float64 {
+	if inp.Curl == 0 {
+		return 0
+	}
+	if r.Intn(2) == 0 {
+		return -inp.Curl
+	}
+	return inp.Curl
+}
+
+// closestArc returns the distance along the arc with curvature k to the
+// first obstacle hit, or a step of at most maxTurn with a nil obstacle.
+func (inp Input) closestArc(x0, y0, vx, vy, k float64) (float64, Obstacle) {
+	closest, hit := maxTurn/math.Abs(k), Obstacle(nil)
+	for _, o := range inp.Obstacles {
+		a, ok := o.(arcObstacle)
+		if !ok {
+			inp.Error(errors.New("obstacle does not support curved paths"))
+		}
+		d, ok := a.ArcDistToColl(x0, y0, vx, vy, k, inp.Ball)
+		if ok && d < closest {
+			closest, hit = d, o
+		}
+	}
+	return closest, hit
+}
+
+// leave makes sure a curling object leaves the obstacle it bounced on at an
+// angle of at least minLeave, keeping its speed. Otherwise an object rolling
+// along a wall would curl straight back into it.
+func leave(o Obstacle, x, y, vx, vy float64) (float64, float64) {
+	s, ok := o.(shaped)
+	if !ok {
+		return vx, vy
+	}
+	cx, cy := s.Closest(x, y)
+	nx, ny := x-cx, y-cy
+	l := math.Sqrt(nx*nx + ny*ny)
+	nx, ny = nx/l, ny/l
+
+	v := math.Sqrt(vx*vx + vy*vy)
+	vn, min := vx*nx+vy*ny, v*math.Sin(minLeave)
+	if vn >= min {
+		return vx, vy
+	}
+	tx, ty := vx-vn*nx, vy-vn*ny
+	if l = math.Sqrt(tx*tx + ty*ty); l > 0 {
+		tx, ty = tx/l, ty/l
+	}
+	vt := math.Sqrt(v*v - min*min)
+	return nx*min + tx*vt, ny*min + ty*vt
+}
+
+func (o Object) curls() bool {
+	return o.Curl != 0 || o.CurlDist != nil
+}
+
+type parseCurl struct{}
+
+func (p parseCurl) Handle(d []string, i *Input) bool {
+	if d[0] != "curl" {
+		return false
+	}
+	o := i.object()
+	i.param(d, &o.Curl, &o.CurlDist)
+	return true
+}
@@ -0,0 +1,254 @@
+package bounces
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/vron/bounces/line"
+	"github.com/vron/bounces/shape"
+)
+
+// batchSize is the number of balls the batch kernel advances together.
+const batchSize = 64
+
+// A kernel advances a batch of independent balls together, the state of the
+// balls being kept in flat arrays and the obstacles in arrays of their
+// concrete types such that the inner loops make no interface calls. It gives
+// the same trajectories as simulate, but only for the scenes accepted by
+// batchable.
+type kernel struct {
+	segs  []line.Segment
+	circs []shape.Circle
+	// order is the index in Obstacles of each segment followed by each
+	// circle, ties being resolved as by closesObstacle
+	order []int
+
+	x, y, vx, vy                         []float64
+	ball, friction, terminal, elasticity []float64
+	dist                                 []float64
+	kind, hit, bounces, jam              []int
+	live                                 []int
+
+	// packed holds the live balls while finding their closest obstacles
+	packed struct {
+		x, y, vx, vy, r, a, v, dist []float64
+		hit                         []int
+	}
+}
+
+// batchable returns whether the batch kernel can simulate the input, i.e. a
+// single ball among static segments and circles with no curl, drop, levels,
+// rooms, wandering or invariant checks. It tests every obstacle, so scenes
+// with as many as are indexed by a grid are faster simulated one by one.
+func (inp Input) batchable() bool {
+	if len(inp.Obstacles) >= minGrid || len(inp.Balls) > 1 || inp.Drop.Height > 0 || inp.Check || len(inp.Movers) > 0 ||
+		len(inp.Levels) > 0 || len(inp.Rooms) > 0 || len(inp.Doors) > 0 ||
+		inp.Wander > 0 || len(inp.Seams) > 0 || (len(inp.Jitters) > 0 && !inp.JitterBlock) {
+		return false
+	}
+	for _, o := range append([]Object{inp.Object}, inp.Objects...) {
+		if o.Curl != 0 || o.CurlDist != nil {
+			return false
+		}
+	}
+	for _, o := range inp.Obstacles {
+		switch o.(type) {
+		case line.Segment, shape.Circle:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (inp Input) newKernel() *kernel {
+	k := &kernel{}
+	for oi, o := range inp.Obstacles {
+		if s, ok := o.(line.Segment); ok {
+			k.segs = append(k.segs, s)
+			k.order = append(k.order, oi)
+		}
+	}
+	for oi, o := range inp.Obstacles {
+		if c, ok := o.(shape.Circle); ok {
+			k.circs = append(k.circs, c)
+			k.order = append(k.order, oi)
+		}
+	}
+	for _, a := range []*[]float64{&k.x, &k.y, &k.vx, &k.vy, &k.ball, &k.friction, &k.terminal, &k.elasticity, &k.dist} {
+		*a = make([]float64, batchSize)
+	}
+	p := &k.packed
+	for _, a := range []*[]float64{&p.x, &p.y, &p.vx, &p.vy, &p.r, &p.a, &p.v, &p.dist} {
+		*a = make([]float64, batchSize)
+	}
+	for _, a := range []*[]int{&k.kind, &k.hit, &k.bounces, &k.jam, &p.hit} {
+		*a = make([]int, batchSize)
+	}
+	k.live = make([]int, 0, batchSize)
+	return k
+}
+
+// run simulates n <= batchSize trajectories, drawing the initial conditions
+// from r in the same order as trajectory does. The final positions are left
+// in x and y.
+func (k *kernel) run(inp Input, r *rand.Rand, n int) {
+	k.live = k.live[:0]
+	for b := 0; b < n; b++ {
+		var o Object
+		o, k.kind[b] = inp.drawObject(r)
+		k.x[b], k.y[b] = inp.Start[0], inp.Start[1]
+		k.vx[b], k.vy[b] = o.Velocity(r)
+		k.ball[b], k.friction[b], k.terminal[b], k.elasticity[b] = o.Ball, o.friction(), o.Terminal, o.Elasticity
+		k.bounces[b], k.jam[b] = 0, 0
+		k.live = append(k.live, b)
+	}
+
+	for steps := 0; len(k.live) > 0; steps++ {
+		if steps == maxSteps {
+			k.fail(inp, errors.New("maxBounce reached - did you have a bad config?"))
+			return
+		}
+		k.stop()
+		k.closest()
+
+		live := k.live[:0]
+		for _, b := range k.live {
+			if k.hit[b] < 0 {
+				inp.Error(errors.New("did not collie with any obstacle"))
+				k.x[b], k.y[b] = 0, 0
+				continue
+			}
+			v := math.Sqrt(k.vx[b]*k.vx[b] + k.vy[b]*k.vy[b])
+			var d float64
+			k.x[b], k.y[b], k.vx[b], k.vy[b], d = advance(math.Max(k.dist[b], 0)*v, k.x[b], k.y[b], k.vx[b], k.vy[b], 0, k.friction[b], k.terminal[b])
+			if math.Sqrt(k.vx[b]*k.vx[b]+k.vy[b]*k.vy[b]) < k.terminal[b] {
+				continue
+			}
+			if d > tol {
+				k.jam[b] = 0
+			} else if k.jam[b]++; k.jam[b] > maxJam {
+				continue
+			}
+			k.bounce(b)
+			if k.bounces[b]++; k.bounces[b] == maxBounce {
+				inp.Error(errors.New("maxBounce reached - did you have a bad config?"))
+				k.x[b], k.y[b] = 0, 0
+				continue
+			}
+			live = append(live, b)
+		}
+		k.live = live
+	}
+}
+
+// stop removes the balls slower than their terminal speed.
+func (k *kernel) stop() {
+	live := k.live[:0]
+	for _, b := range k.live {
+		if math.Sqrt(k.vx[b]*k.vx[b]+k.vy[b]*k.vy[b]) >= k.terminal[b] {
+			live = append(live, b)
+		}
+	}
+	k.live = live
+}
+
+// closest sets dist and hit of every live ball to its first obstacle, hit
+// indexing the segments followed by the circles. The live balls are first
+// packed together, the distances being computed as by DistToColl of the
+// obstacles with the quantities depending on only the ball or only the
+// obstacle computed once.
+func (k *kernel) closest() {
+	m := len(k.live)
+	p := &k.packed
+	for i, b := range k.live {
+		p.x[i], p.y[i], p.vx[i], p.vy[i], p.r[i] = k.x[b], k.y[b], k.vx[b], k.vy[b], k.ball[b]
+		p.a[i] = p.vx[i]*p.vx[i] + p.vy[i]*p.vy[i]
+		p.v[i] = math.Sqrt(p.a[i])
+		p.dist[i], p.hit[i] = math.MaxFloat64, -1
+	}
+	x, y, vx, vy, r, v := p.x[:m], p.y[:m], p.vx[:m], p.vy[:m], p.r[:m], p.v[:m]
+	for si, s := range k.segs {
+		l := math.Sqrt(s[2]*s[2] + s[3]*s[3])
+		snx, sny, ll := -s[3]/l, s[2]/l, l*l
+		for i := range x {
+			nx, ny := snx, sny
+			h := (x[i]-s[0])*nx + (y[i]-s[1])*ny
+			if r[i] <= tol && math.Abs(h) <= tol {
+				continue
+			}
+			if h < 0 {
+				nx, ny, h = -nx, -ny, -h
+			}
+			vn := nx*vx[i] + ny*vy[i]
+			if vn >= -tol*v[i] {
+				continue
+			}
+			t := math.Max(0, (h-r[i])/-vn)
+			if u := ((x[i]+vx[i]*t-s[0])*s[2] + (y[i]+vy[i]*t-s[1])*s[3]) / ll; u < 0 || u > 1 {
+				continue
+			}
+			k.closer(i, si, t)
+		}
+	}
+	for ci, c := range k.circs {
+		for i := range x {
+			fx, fy := x[i]-c.X, y[i]-c.Y
+			b := 2 * (fx*vx[i] + fy*vy[i])
+			if b >= 0 || r[i]+c.R <= tol {
+				continue
+			}
+			f := fx*fx + fy*fy
+			cc := f - (r[i]+c.R)*(r[i]+c.R)
+			d := b*b - 4*p.a[i]*cc
+			if cc > 0 && d <= 0 {
+				continue
+			}
+			if b >= -2*tol*math.Sqrt(p.a[i]*f) {
+				continue
+			}
+			t := 0.0
+			if cc > 0 {
+				t = 2 * cc / (-b + math.Sqrt(d))
+			}
+			k.closer(i, len(k.segs)+ci, t)
+		}
+	}
+	for i, b := range k.live {
+		k.dist[b], k.hit[b] = p.dist[i], p.hit[i]
+	}
+}
+
+// closer records the obstacle oi as hit by the packed ball i if it is hit
+// before the closest one so far.
+func (k *kernel) closer(i, oi int, d float64) {
+	p := &k.packed
+	if d > -tol && (d < p.dist[i] || (d == p.dist[i] && k.order[oi] < k.order[p.hit[i]])) {
+		p.dist[i], p.hit[i] = d, oi
+	}
+}
+
+// bounce bounces ball b on the obstacle it hit, moving it out of the
+// obstacle if it overlaps it due to rounding.
+func (k *kernel) bounce(b int) {
+	x, y, r := k.x[b], k.y[b], k.ball[b]
+	var cx, cy float64
+	if h := k.hit[b]; h < len(k.segs) {
+		k.vx[b], k.vy[b] = k.segs[h].Bounce(x, y, k.vx[b], k.vy[b], r, k.elasticity[b])
+		cx, cy = k.segs[h].Closest(x, y)
+	} else {
+		k.vx[b], k.vy[b] = k.circs[h-len(k.segs)].Bounce(x, y, k.vx[b], k.vy[b], r, k.elasticity[b])
+		cx, cy = k.circs[h-len(k.segs)].Closest(x, y)
+	}
+	k.x[b], k.y[b] = push(cx, cy, x, y, r)
+}
+
+// fail reports an error for, and resets, all balls still moving.
+func (k *kernel) fail(inp Input, err error) {
+	for _, b := range k.live {
+		inp.Error(err)
+		k.x[b], k.y[b] = 0, 0
+	}
+	k.live = k.live[:0]
+}
@@ -0,0 +1,59 @@
+package bounces
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	for _, inp := range []Input{readScene(t, "../geo/04_geo_with.txt"), clutteredScene(rand.New(rand.NewSource(1)), 1000)} {
+		// the kernel handles any number of obstacles, but is only used for
+		// those too few for a grid
+		if b := len(inp.Obstacles) < minGrid; inp.batchable() != b {
+			t.Fatal("expected batchable:", b, "with", len(inp.Obstacles), "obstacles")
+		}
+		inp.index()
+		k := inp.newKernel()
+		r0, r1 := rand.New(rand.NewSource(2)), rand.New(rand.NewSource(2))
+		o := inp.newOutcome()
+		for i := 0; i < 10; i++ {
+			k.run(inp, r1, batchSize)
+			for b := 0; b < batchSize; b++ {
+				inp.trajectory(r0, &o)
+				if o.x[0] != k.x[b] || o.y[0] != k.y[b] || o.kind[0] != k.kind[b] {
+					t.Error("expected:", o.x[0], o.y[0], o.kind[0], "got: ", k.x[b], k.y[b], k.kind[b])
+				}
+			}
+		}
+	}
+}
+
+func TestBatchRun(t *testing.T) {
+	inp := readScene(t, "../geo/04_geo_with.txt")
+	inp.ImageRes = 64
+	a := Run(inp, 0, 1000, 1000)
+	inp.Batch = true
+	b := Run(inp, 0, 1000, 1000)
+	t.Log("expected:", a.Measures, "got: ", b.Measures)
+	if a.Measures[0] != b.Measures[0] || a.MeasureErrors[0] != b.MeasureErrors[0] {
+		t.Error()
+	}
+}
+
+func BenchmarkBatch(b *testing.B) {
+	inp := readScene(b, "../geo/04_geo_with.txt")
+	b.Run("scalar", func(b *testing.B) {
+		r := rand.New(rand.NewSource(1))
+		o := inp.newOutcome()
+		for i := 0; i < b.N; i++ {
+			inp.trajectory(r, &o)
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		r := rand.New(rand.NewSource(1))
+		k := inp.newKernel()
+		for i := 0; i < b.N; i += batchSize {
+			k.run(inp, r, batchSize)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package bounces
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// maxViolations is the number of violations kept as examples, all are
+// counted.
+const maxViolations = 100
+
+// A Violation is a physical invariant found broken when running with Check,
+// along the trajectory such that it can be replayed.
+type Violation struct {
+	Kind string
+	Trajectory
+	Bounce int
+	X, Y   float64
+	Detail string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%v, trajectory %v bounce %v at %.4g %.4g: %v", v.Kind, v.Trajectory, v.Bounce, v.X, v.Y, v.Detail)
+}
+
+// checker verifies the invariants along a trajectory if report is set.
+type checker struct {
+	world  [4]float64
+	report func(kind string, bounce int, x, y float64, detail string)
+}
+
+func (c checker) on() bool {
+	return c.report != nil
+}
+
+// start sets the world to the bounds of the obstacles.
+func (c *checker) start(inp Input) {
+	if len(inp.Obstacles) == 0 {
+		c.world = [4]float64{math.Inf(-1), math.Inf(-1), math.Inf(1), math.Inf(1)}
+		return
+	}
+	c.world[0], c.world[1], c.world[2], c.world[3] = inp.bounds()
+}
+
+// position checks that a ball of radius r at (x, y) at the time t does not
+// penetrate any obstacle and is inside the world.
+func (inp Input) checkPosition(bounce int, t, x, y, r float64) {
+	if p, o := inp.penetration(x, y, r); p > maxPenetration {
+		inp.check.report("penetration", bounce, x, y, fmt.Sprintf("overlaps %v by %.3g", o, p))
+	}
+	for _, m := range inp.Movers {
+		cx, cy := m.ClosestAt(t, x, y)
+		if p := r - math.Hypot(x-cx, y-cy); p > maxPenetration {
+			inp.check.report("penetration", bounce, x, y, fmt.Sprintf("overlaps a moving obstacle by %.3g", p))
+		}
+	}
+	w := inp.check.world
+	if x < w[0]-maxPenetration || y < w[1]-maxPenetration || x > w[0]+w[2]+maxPenetration || y > w[1]+w[3]+maxPenetration {
+		inp.check.report("outside", bounce, x, y, fmt.Sprintf("outside of the world %.4g", w))
+	}
+}
+
+// checkEnergy checks that the kinetic energy e0 did not increase to e1 at a
+// bounce which should not add energy.
+func (inp Input) checkEnergy(bounce int, x, y, e0, e1 float64) {
+	if e1 > e0*(1+1e-9)+tol {
+		inp.check.report("energy", bounce, x, y, fmt.Sprintf("increased from %.6g to %.6g", e0, e1))
+	}
+}
+
+// violations aggregates the violations of all blocks.
+type violations struct {
+	sync.Mutex
+	list  []Violation
+	count int64
+}
+
+// add counts the violation, keeping the first ones by block seed, index,
+// bounce and description such that the examples do not depend on the order
+// the blocks finish in.
+func (vs *violations) add(v Violation) {
+	vs.Lock()
+	defer vs.Unlock()
+	vs.count++
+	vs.insert(v)
+}
+
+// merge adds the count violations of a block, of which list holds the first.
+func (vs *violations) merge(list []Violation, count int64) {
+	vs.Lock()
+	defer vs.Unlock()
+	vs.count += count
+	for _, v := range list {
+		vs.insert(v)
+	}
+}
+
+// insert keeps v if it is among the first maxViolations, vs being locked.
+func (vs *violations) insert(v Violation) {
+	i := sort.Search(len(vs.list), func(i int) bool {
+		return v.before(vs.list[i])
+	})
+	if i >= maxViolations {
+		return
+	}
+	if len(vs.list) < maxViolations {
+		vs.list = append(vs.list, Violation{})
+	}
+	copy(vs.list[i+1:], vs.list[i:])
+	vs.list[i] = v
+}
+
+// before orders violations by block seed, index, bounce and description.
+func (v Violation) before(w Violation) bool {
+	if v.Seed != w.Seed {
+		return v.Seed < w.Seed
+	}
+	if v.Index != w.Index {
+		return v.Index < w.Index
+	}
+	if v.Bounce != w.Bounce {
+		return v.Bounce < w.Bounce
+	}
+	return v.String() < w.String()
+}
@@ -0,0 +1,105 @@
+package bounces
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/vron/bounces/line"
+)
+
+// TestViolationsAdd adds violations in a random order, which must keep the
+// same first ones as sorting all of them.
+func TestViolationsAdd(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	vs := violations{}
+	for _, k := range r.Perm(3 * maxViolations) {
+		vs.add(Violation{Kind: "energy", Trajectory: Trajectory{int64(k / 10), k % 10}})
+	}
+	if vs.count != 3*maxViolations || len(vs.list) != maxViolations {
+		t.Log("expected:", 3*maxViolations, maxViolations, "got: ", vs.count, len(vs.list))
+		t.Error()
+	}
+	for k, v := range vs.list {
+		if v.Seed != int64(k/10) || v.Index != k%10 {
+			t.Log("expected:", k/10, k%10, "got: ", v.Seed, v.Index)
+			t.Error()
+		}
+	}
+}
+
+// checkedRoom is a room the ball is thrown across, into the right wall.
+const checkedRoom = `ball 0.05
+velocity uniform 1 1
+start 2.5 1.5
+friction -0.1
+terminal 0.01
+elasticity 0.5
+
+line 0 0 5 0
+line 5 0 5 3
+line 5 3 0 3
+line 0 3 0 0
+
+measure all 0 0 5 3
+`
+
+// boost is a wall that throws the ball back a little faster than it came.
+type boost struct {
+	line.Segment
+}
+
+func (b boost) Bounce(x, y, vx, vy, r, el float64) (float64, float64) {
+	vx, vy = b.Segment.Bounce(x, y, vx, vy, r, el)
+	return 1.1 * vx, 1.1 * vy
+}
+
+// TestCheck runs scenes that break each of the invariants, and one that
+// breaks none of them.
+func TestCheck(t *testing.T) {
+	// a wall adding energy to a fully elastic ball
+	inp := parseScene(t, strings.Replace(checkedRoom, "elasticity 0.5", "elasticity 1", 1))
+	for i, o := range inp.Obstacles {
+		if s, ok := o.(line.Segment); ok && s[0] == 5 {
+			inp.Obstacles[i] = boost{s}
+		}
+	}
+	checked(t, inp, 1, 0, "energy")
+
+	// a start closer to the floor than the radius of the ball
+	checked(t, parseScene(t, strings.Replace(checkedRoom, "start 2.5 1.5", "start 2.5 0.02", 1)), 1, 0, "penetration")
+
+	// a start outside of the room, stopping before the right wall
+	checked(t, parseScene(t, strings.Replace(checkedRoom, "start 2.5 1.5", "start 8 1.5", 1)), -0.5, 0, "outside")
+
+	// nothing at all in a clean scene
+	inp = readScene(t, "../geo/04_geo_with.txt")
+	inp.ImageRes = 64
+	inp.Check = true
+	res := Run(inp, 0, 20000, 20000)
+	t.Log("expected no violations, got: ", res.ViolationCount, res.Violations)
+	if res.ViolationCount != 0 || len(res.Violations) != 0 {
+		t.Error()
+	}
+}
+
+// checked runs the input with the ball thrown with (vx, vy), which must
+// break the invariant kind in every trajectory.
+func checked(t *testing.T, inp Input, vx, vy float64, kind string) {
+	inp.Velocity = func(r *rand.Rand) (float64, float64) {
+		return vx, vy
+	}
+	inp.ImageRes = 64
+	inp.Check = true
+	res := Run(inp, 0, 1000, 1000)
+	found := int64(0)
+	for _, v := range res.Violations {
+		if v.Kind == kind {
+			found++
+		}
+	}
+	t.Log("expected:", res.Samples, kind, "got: ", res.ViolationCount, found)
+	if found == 0 || res.ViolationCount < res.Samples {
+		t.Error()
+	}
+}
@@ -0,0 +1,100 @@
+package bounces
+
+import (
+	"encoding/gob"
+	"errors"
+	"os"
+)
+
+// A checkpoint is the complete state of a run, from which it can be resumed
+// giving the same results as if it had never stopped. Of the block seeds
+// drawn from the seed of the run Drawn have been used, those of the blocks
+// not in the counts are Pending, by replicate, to be simulated again.
+type checkpoint struct {
+	Counts    Counts
+	Drawn     int64
+	BlockSize int
+	Pending   [][]int64
+}
+
+// snapshot returns the checkpoint of the blocks merged so far, locking the
+// results rather than waiting for the blocks being simulated.
+func (inp Input) snapshot(res []*result, seed int64, viol *violations, drawn int64, blockSize int) checkpoint {
+	img := res[0].image
+	img.Lock()
+	defer img.Unlock()
+	for _, r := range res {
+		r.Lock()
+		defer r.Unlock()
+	}
+	viol.Lock()
+	defer viol.Unlock()
+	c := checkpoint{inp.counts(res, seed, viol), drawn, blockSize, nil}
+	n := &c.Counts
+	n.Image = append([]int32(nil), n.Image...)
+	n.Violations = append([]Violation(nil), n.Violations...)
+	for i, r := range res {
+		n.Measures[i] = append([]int64(nil), r.measures...)
+		n.Cases[i] = append([]int64(nil), r.cases...)
+		c.Pending = append(c.Pending, append([]int64(nil), r.pending...))
+	}
+	return c
+}
+
+// save writes the checkpoint to p, replacing any earlier one only once it
+// is completely written.
+func (c checkpoint) save(p string) error {
+	f, err := os.Create(p + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(c); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(p+".tmp", p)
+}
+
+func loadCheckpoint(p string) (checkpoint, error) {
+	c := checkpoint{}
+	f, err := os.Open(p)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(&c); err != nil {
+		return c, err
+	}
+	if c.Counts.Version != countsVersion {
+		return c, errors.New("unsupported checkpoint version")
+	}
+	return c, nil
+}
+
+// restore sets the results to the state of the checkpoint, if it was made
+// for the same scene and run.
+func (c checkpoint) restore(inp Input, res []*result, seed int64, blockSize int, viol *violations) error {
+	n := c.Counts
+	switch {
+	case n.Hash != inp.Hash:
+		return errors.New("the scene has changed since the checkpoint")
+	case len(n.Seeds) != 1 || n.Seeds[0] != seed || c.BlockSize != blockSize || len(n.No) != len(res):
+		return errors.New("the checkpoint is of a run with other seed, block size or replicates")
+	case len(n.Image) != len(res[0].image.image):
+		return errors.New("the checkpoint is of a run with another image resolution")
+	case len(n.Columns) != len(res[0].columns):
+		return errors.New("the checkpoint is of a run with other measures")
+	}
+	for i, r := range res {
+		r.no = n.No[i]
+		copy(r.measures, n.Measures[i])
+		copy(r.cases, n.Cases[i])
+	}
+	copy(res[0].image.image, n.Image)
+	res[0].logged, res[0].logCount, res[0].jammed = n.Logged, n.LoggedCount, n.Jammed
+	viol.list, viol.count = n.Violations, n.ViolationCount
+	return nil
+}
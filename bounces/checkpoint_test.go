@@ -0,0 +1,57 @@
+package bounces
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bounces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inp := readScene(t, "../geo/04_geo_with.txt")
+	inp.ImageRes = 64
+	full := Run(inp, 0, 1000, 320000)
+
+	inp.Checkpoint, inp.CheckpointEvery = filepath.Join(dir, "04.checkpoint"), time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	part := RunContext(ctx, inp, 0, 1000, 320000)
+	inp.Resume = true
+	resumed := Run(inp, 0, 1000, 320000)
+
+	t.Log("expected:", full.Samples, full.Measures, "got: ", part.Samples, resumed.Samples, resumed.Measures)
+	if !part.Partial || part.Samples >= full.Samples || fmt.Sprint(full.Measures, full.Image) != fmt.Sprint(resumed.Measures, resumed.Image) {
+		t.Error()
+	}
+
+	// without a checkpoint to resume from the run starts over
+	inp.Checkpoint = filepath.Join(dir, "none.checkpoint")
+	fresh := Run(inp, 0, 1000, 320000)
+	t.Log("expected:", full.Measures, "got: ", fresh.Measures)
+	if fmt.Sprint(full.Measures, full.Image) != fmt.Sprint(fresh.Measures, fresh.Image) {
+		t.Error()
+	}
+
+	// a changed scene is not resumed
+	inp.Hash = "other"
+	var got error
+	inp.Error = func(e error, a ...interface{}) {
+		if e != nil {
+			got = e
+		}
+	}
+	Run(inp, 0, 1000, 320000)
+	t.Log("expected: an error got: ", got)
+	if got == nil {
+		t.Error()
+	}
+}
@@ -0,0 +1,62 @@
+package bounces
+
+import (
+	"math"
+
+	"github.com/vron/bounces/shape"
+)
+
+// maxPenetration is how far the ball may overlap an obstacle due to rounding
+// before it is considered to have penetrated it.
+const maxPenetration = 1e-6
+
+// penetration returns how far a ball of radius r at (x, y) overlaps the
+// obstacle it overlaps the most, or a negative value if there is none.
+func (inp Input) penetration(x, y, r float64) (float64, Obstacle) {
+	worst, hit := math.Inf(-1), Obstacle(nil)
+	for _, o := range inp.Obstacles {
+		c, ok := clearance(o, x, y)
+		if ok && r-c > worst {
+			worst, hit = r-c, o
+		}
+	}
+	return worst, hit
+}
+
+// clearance returns the distance from (x, y) to the surface of the obstacle,
+// negative inside of a circle.
+func clearance(o Obstacle, x, y float64) (float64, bool) {
+	if c, ok := o.(coated); ok {
+		o = c.surface
+	}
+	switch o := o.(type) {
+	case shape.Circle:
+		return math.Hypot(x-o.X, y-o.Y) - o.R, true
+	case shaped:
+		cx, cy := o.Closest(x, y)
+		return math.Hypot(x-cx, y-cy), true
+	}
+	return 0, false
+}
+
+// separate moves a ball overlapping an obstacle, e.g. due to rounding after
+// a bounce, out along the contact normal such that it just touches it.
+func (inp Input) separate(o Obstacle, x, y, r float64) (float64, float64) {
+	s, ok := o.(shaped)
+	if !ok {
+		return x, y
+	}
+	cx, cy := s.Closest(x, y)
+	return push(cx, cy, x, y, r)
+}
+
+// push moves a ball of radius r at (x, y) away from the closest point
+// (cx, cy) of an obstacle until it just touches it.
+func push(cx, cy, x, y, r float64) (float64, float64) {
+	dx, dy := x-cx, y-cy
+	d := math.Sqrt(dx*dx + dy*dy)
+	if d >= r || d == 0 {
+		return x, y
+	}
+	return cx + dx/d*r, cy + dy/d*r
+}
@@ -0,0 +1,154 @@
+package bounces
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/vron/bounces/line"
+	"github.com/vron/bounces/shape"
+)
+
+// randomRoom returns a star shaped room around the origin, with some pillars,
+// in which the ball fits at the origin. It often starts in contact with a
+// wall and is perfectly elastic or inelastic.
+func randomRoom(r *rand.Rand) (Input, []float64) {
+	n := 3 + r.Intn(8)
+	as := make([]float64, n)
+	for k := range as {
+		as[k] = 2 * math.Pi * (float64(k) + 0.8*r.Float64()) / float64(n)
+	}
+	outline := []float64{}
+	for _, a := range as {
+		d := 1 + 4*r.Float64()
+		outline = append(outline, d*math.Cos(a), d*math.Sin(a))
+	}
+	if !(Level{Outline: outline}).contains(0, 0) || r.Intn(4) == 0 {
+		// axis aligned rooms have many exact corners
+		w, h := 1+r.Float64()*4, 1+r.Float64()*4
+		outline = []float64{-w, -h, w, -h, w, h, -w, h}
+	}
+
+	inp := Input{Error: func(e error, a ...interface{}) {
+		if e != nil {
+			panic(fmt.Sprint(append(a, e)...))
+		}
+	}}
+	for _, e := range (Level{Outline: outline}).edges() {
+		inp.Obstacles = append(inp.Obstacles, e, shape.NewCircle(e[0], e[1], 0))
+	}
+	inp.Ball = 0.001 + 0.2*r.Float64()
+	for k := r.Intn(4); k > 0; k-- {
+		x, y := 4*r.Float64()-2, 4*r.Float64()-2
+		R := 0.5 * r.Float64()
+		if math.Hypot(x, y) > R+inp.Ball+0.01 {
+			inp.Obstacles = append(inp.Obstacles, shape.NewCircle(x, y, R))
+		}
+	}
+	if r.Intn(2) == 0 {
+		// a wall starting exactly at a corner, and a loose one
+		inp.Obstacles = append(inp.Obstacles, line.SegmentFromPoints(outline[0], outline[1], outline[0]/2, outline[1]/2))
+		inp.Obstacles = append(inp.Obstacles, shape.NewCircle(outline[0]/2, outline[1]/2, 0))
+	}
+	for p, _ := inp.penetration(0, 0, inp.Ball); p > 0; p, _ = inp.penetration(0, 0, inp.Ball) {
+		inp.Ball /= 2
+	}
+	inp.check.report = func(kind string, bounce int, x, y float64, detail string) {
+		// jams are counted by TestRandomRooms
+		if kind != "jam" {
+			panic(fmt.Sprint(kind, " at bounce ", bounce, " ", detail))
+		}
+	}
+	inp.Friction = -0.2 - 2*r.Float64()
+	inp.Terminal = 0.01
+	inp.Elasticity = []float64{0, 1, r.Float64()}[r.Intn(3)]
+	if r.Intn(4) == 0 {
+		// start touching, or slightly overlapping, a wall
+		e := inp.Obstacles[0].(line.Segment)
+		l := math.Hypot(e[2], e[3])
+		nx, ny := -e[3]/l, e[2]/l
+		if nx*e[0]+ny*e[1] > 0 {
+			nx, ny = -nx, -ny
+		}
+		o := inp.Ball * (1 - 1e-9*float64(r.Intn(2)))
+		inp.Start = [2]float64{e[0] + e[2]/2 + nx*o, e[1] + e[3]/2 + ny*o}
+		if p, _ := inp.penetration(inp.Start[0], inp.Start[1], inp.Ball); p > 1e-8 {
+			inp.Start = [2]float64{}
+		}
+	}
+	inp.Velocity = func(r *rand.Rand) (float64, float64) {
+		a, v := 2*math.Pi*r.Float64(), 10*r.Float64()
+		return v * math.Cos(a), v * math.Sin(a)
+	}
+	return inp, outline
+}
+
+// maxJams is how many of the trajectories of TestRandomRooms may jam, the
+// walls starting at corners making wedges the ball can get stuck in.
+const maxJams = 60
+
+func TestRandomRooms(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	jams := 0
+	for room := 0; room < 2000; room++ {
+		inp, outline := randomRoom(r)
+		for k := 0; k < 10; k++ {
+			seed := int64(room*10 + k)
+			x, y, ok, err := simulateSafe(&inp, rand.New(rand.NewSource(seed)))
+			switch {
+			case err != nil:
+				t.Error("room", room, "seed", seed, "failed:", err)
+			case !ok:
+				jams++
+			case !(Level{Outline: outline}).contains(x, y):
+				t.Error("room", room, "seed", seed, "ended at", x, y)
+			}
+		}
+	}
+	t.Log("expected at most:", maxJams, "got: ", jams, "jams")
+	if jams > maxJams {
+		t.Error()
+	}
+}
+
+// simulateSafe simulates the ball, ok being false if it jammed and err set
+// if it failed or broke an invariant.
+func simulateSafe(inp *Input, r *rand.Rand) (x, y float64, ok bool, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	x, y, _, ok = inp.simulate(r)
+	return x, y, ok, nil
+}
+
+// TestJammed runs a room in which balls jam, which must be counted apart
+// from the image.
+func TestJammed(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for room := 0; room < 2000; room++ {
+		inp, _ := randomRoom(r)
+		jammed := false
+		for k := 0; k < 10 && !jammed; k++ {
+			_, _, ok, _ := simulateSafe(&inp, rand.New(rand.NewSource(int64(room*10+k))))
+			jammed = !ok
+		}
+		if !jammed {
+			continue
+		}
+		inp.ImageRes = 16
+		res := Run(inp, 0, 10000, 10000)
+		sum := int64(0)
+		for _, c := range res.Image {
+			sum += int64(c)
+		}
+		t.Log("expected:", res.Samples, "got: ", sum, "+", res.Jammed, "jammed")
+		if res.Jammed == 0 || sum+res.Jammed != res.Samples {
+			t.Error()
+		}
+		return
+	}
+	t.Fatal("expected a room in which balls jam")
+}
@@ -0,0 +1,184 @@
+package bounces
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// countsVersion is increased whenever the format of Counts changes.
+const countsVersion = 2
+
+// Counts are what a run counted, from which its Results are computed. The
+// counts of runs of the same scene with different seeds can be merged,
+// giving the results of one run with the replicates of all of them.
+type Counts struct {
+	Version int
+	Hash    string
+	Seeds   []int64
+	Columns []string
+	Targets []Target
+
+	// per replicate the number of trajectories, and for each measure the
+	// number of hits and cases
+	No       []int64
+	Measures [][]int64
+	Cases    [][]int64
+
+	Bounds         [4]float64
+	Image          []int32
+	Violations     []Violation
+	ViolationCount int64
+	Logged         []Trajectory
+	LoggedCount    int64
+	// Jammed is the number of trajectories, of all replicates, not counted
+	Jammed int64
+}
+
+func (inp Input) counts(results []*result, seed int64, viol *violations) Counts {
+	c := Counts{
+		Version:        countsVersion,
+		Hash:           inp.Hash,
+		Seeds:          []int64{seed},
+		Bounds:         results[0].image.bounds,
+		Image:          results[0].image.image,
+		Violations:     viol.list,
+		ViolationCount: viol.count,
+	}
+	for _, m := range results[0].columns {
+		c.Columns = append(c.Columns, m.Name)
+		c.Targets = append(c.Targets, m.Target)
+	}
+	for _, r := range results {
+		c.No = append(c.No, r.no)
+		c.Measures = append(c.Measures, r.measures)
+		c.Cases = append(c.Cases, r.cases)
+		c.Logged = append(c.Logged, r.logged...)
+		c.LoggedCount += r.logCount
+		c.Jammed += r.jammed
+	}
+	c.Logged = firstTrajectories(c.Logged)
+	return c
+}
+
+// Write writes the counts in a versioned binary format.
+func (c Counts) Write(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(c)
+}
+
+// ReadCounts reads counts written by Write.
+func ReadCounts(r io.Reader) (Counts, error) {
+	c := Counts{}
+	if err := gob.NewDecoder(r).Decode(&c); err != nil {
+		return c, err
+	}
+	if c.Version != countsVersion {
+		return c, fmt.Errorf("unsupported counts version %v, expected %v", c.Version, countsVersion)
+	}
+	return c, nil
+}
+
+// MergeCounts adds the counts of several runs of the same scene, with the
+// same measures and image, but different seeds.
+func MergeCounts(cs ...Counts) (Counts, error) {
+	if len(cs) == 0 {
+		return Counts{}, errors.New("nothing to merge")
+	}
+	m := cs[0]
+	m.Seeds = append([]int64{}, m.Seeds...)
+	m.No = append([]int64{}, m.No...)
+	m.Measures = append([][]int64{}, m.Measures...)
+	m.Cases = append([][]int64{}, m.Cases...)
+	m.Image = append([]int32{}, m.Image...)
+	vs := violations{}
+	vs.merge(m.Violations, m.ViolationCount)
+	m.Logged = append([]Trajectory{}, m.Logged...)
+	for _, c := range cs[1:] {
+		switch {
+		case c.Hash != m.Hash:
+			return m, errors.New("the counts are of different scenes")
+		case fmt.Sprint(c.Columns) != fmt.Sprint(m.Columns):
+			return m, errors.New("the counts are of different measures")
+		case len(c.Image) != len(m.Image) || c.Bounds != m.Bounds:
+			return m, errors.New("the counts are of images of different resolution or bounds")
+		}
+		for _, s := range c.Seeds {
+			for _, t := range m.Seeds {
+				if s == t {
+					return m, fmt.Errorf("the seed %v is in several counts", s)
+				}
+			}
+		}
+		m.Seeds = append(m.Seeds, c.Seeds...)
+		m.No = append(m.No, c.No...)
+		m.Measures = append(m.Measures, c.Measures...)
+		m.Cases = append(m.Cases, c.Cases...)
+		for i := range c.Image {
+			m.Image[i] += c.Image[i]
+		}
+		vs.merge(c.Violations, c.ViolationCount)
+		m.Logged = firstTrajectories(append(m.Logged, c.Logged...))
+		m.LoggedCount += c.LoggedCount
+		m.Jammed += c.Jammed
+	}
+	m.Violations, m.ViolationCount = vs.list, vs.count
+	return m, nil
+}
+
+// Results computes the measures and their intervals, at the level
+// confidence by the method iv, with prec the precision for measures without
+// a target of their own.
+func (c Counts) Results(iv Interval, confidence, prec float64) Results {
+	r := Results{
+		Image:          c.Image,
+		Confidence:     confidence,
+		Interval:       iv,
+		Replicates:     len(c.No),
+		Limiting:       -1,
+		Counts:         c,
+		Violations:     c.Violations,
+		ViolationCount: c.ViolationCount,
+		Logged:         c.Logged,
+		LoggedCount:    c.LoggedCount,
+		Jammed:         c.Jammed,
+	}
+	for _, no := range c.No {
+		r.Samples += no
+	}
+
+	worst := 0.0
+	for mi, name := range c.Columns {
+		r.Names = append(r.Names, name)
+		hits := make([]int64, 0, len(c.No))
+		cases := make([]int64, 0, len(c.No))
+		for ri := range c.No {
+			hits, cases = append(hits, c.Measures[ri][mi]), append(cases, c.Cases[ri][mi])
+		}
+		v, lo, hi := iv.bounds(confidence, hits, cases)
+		r.Measures = append(r.Measures, v)
+		r.Lower, r.Upper = append(r.Lower, lo), append(r.Upper, hi)
+		t := c.Targets[mi]
+		e, w := (hi-lo)/2, t.width(v, prec)
+		r.MeasureErrors = append(r.MeasureErrors, e)
+		r.Targets = append(r.Targets, w)
+		r.ReportOnly = append(r.ReportOnly, t.ReportOnly)
+		if t.ReportOnly {
+			continue
+		}
+		// how far the measure is from its target
+		ratio := e / w
+		if e == 0 {
+			ratio = 0
+		}
+		if math.IsNaN(ratio) {
+			continue
+		}
+		if r.Limiting < 0 || ratio > worst {
+			worst, r.Limiting = ratio, mi
+		}
+	}
+	r.Converged = worst <= 1
+	return r
+}
@@ -0,0 +1,79 @@
+package bounces
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// TestMergeCounts merges the counts of two runs with different seeds, one
+// of them written and read back.
+func TestMergeCounts(t *testing.T) {
+	inp := readScene(t, "../geo/04_geo_with.txt")
+	inp.ImageRes = 64
+	inp.Seed = 1
+	a := Run(inp, 0, 1000, 5000).Counts
+	inp.Seed = 2
+	rb := Run(inp, 0, 1000, 5000)
+
+	buf := &bytes.Buffer{}
+	if err := rb.Counts.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadCounts(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := MergeCounts(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra, rm := a.Results(BatchMeans, 0.95, 0), m.Results(BatchMeans, 0.95, 0)
+	mean := (ra.Measures[0] + rb.Measures[0]) / 2
+	t.Log("expected:", ra.Samples+rb.Samples, mean, "got: ", rm.Samples, rm.Measures[0])
+	if rm.Samples != ra.Samples+rb.Samples || rm.Replicates != 10 || math.Abs(rm.Measures[0]-mean) > 1e-12 ||
+		ra.Measures[0] == rb.Measures[0] || fmt.Sprint(m.Seeds) != "[1 2]" {
+		t.Error()
+	}
+	for i := range ra.Image {
+		if rm.Image[i] != ra.Image[i]+rb.Image[i] {
+			t.Error("expected:", ra.Image[i]+rb.Image[i], "got: ", rm.Image[i], "at", i)
+			break
+		}
+	}
+
+	// the same seed, or another scene, can not be merged
+	if _, err := MergeCounts(a, a); err == nil {
+		t.Error("expected an error merging the same seed")
+	}
+	b.Hash = "other"
+	if _, err := MergeCounts(a, b); err == nil {
+		t.Error("expected an error merging another scene")
+	}
+}
+
+// TestMergeViolations merges counts whose violations interleave, which must
+// keep the first ones of both as a single run would.
+func TestMergeViolations(t *testing.T) {
+	a, b := Counts{Seeds: []int64{1}, ViolationCount: 150}, Counts{Seeds: []int64{2}, ViolationCount: 120}
+	for k := 0; k < maxViolations; k++ {
+		a.Violations = append(a.Violations, Violation{Kind: "energy", Trajectory: Trajectory{int64(2 * k), 0}})
+		b.Violations = append(b.Violations, Violation{Kind: "energy", Trajectory: Trajectory{int64(2*k + 1), 0}})
+	}
+	m, err := MergeCounts(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("expected:", 270, maxViolations, "got: ", m.ViolationCount, len(m.Violations))
+	if m.ViolationCount != 270 || len(m.Violations) != maxViolations {
+		t.Error()
+	}
+	for k, v := range m.Violations {
+		if v.Seed != int64(k) {
+			t.Log("expected:", k, "got: ", v.Seed)
+			t.Error()
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package bounces
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+const gravity = 9.81
+
+// minHop is the smallest height of a bounce on the floor, below which the
+// ball is considered to be rolling.
+const minHop = 1e-3
+
+// Drop describes an initial fall from Height, during which the ball bounces
+// on the floor with the coefficient of restitution Restitution. Every bounce
+// changes the direction by a normal distributed angle with the standard
+// deviation Scatter.
+type Drop struct {
+	Height      float64
+	Restitution float64
+	Scatter     float64
+}
+
+// fall lets the ball fall from the height h, moving with the horizontal
+// velocity (vx, vy) and bouncing on walls as well as the floor, until it
+// starts rolling. The state when it starts rolling and the time it took is
+// returned.
+func (inp Input) fall(r *rand.Rand, h, x, y, vx, vy float64) (float64, float64, float64, float64, float64) {
+	z, vz, t := h, 0.0, 0.0
+	for i := 0; i < maxBounce; i++ {
+		tf := (vz + math.Sqrt(vz*vz+2*gravity*z)) / gravity
+		tw, wall := math.Inf(1), Obstacle(nil)
+		if v := math.Sqrt(vx*vx + vy*vy); v > 0 {
+			var d float64
+			d, wall = inp.closesObstacle(x, y, vx, vy, inp.Ball)
+			tw = d / v
+		}
+
+		if tw < tf {
+			x, y, t = x+vx*tw, y+vy*tw, t+tw
+			z, vz = z+vz*tw-gravity*tw*tw/2, vz-gravity*tw
+			vx, vy = wall.Bounce(x, y, vx, vy, inp.Ball, inp.Elasticity)
+			continue
+		}
+
+		x, y, t = x+vx*tf, y+vy*tf, t+tf
+		z, vz = 0, inp.Drop.Restitution*(gravity*tf-vz)
+		if inp.Drop.Scatter > 0 {
+			sin, cos := math.Sincos(r.NormFloat64() * inp.Drop.Scatter)
+			vx, vy = vx*cos-vy*sin, vx*sin+vy*cos
+		}
+		if vz*vz/(2*gravity) < minHop {
+			return x, y, vx, vy, t
+		}
+	}
+
+	inp.Error(errors.New("maxBounce reached while falling - did you have a bad config?"))
+	return x, y, 0, 0, t
+}
+
+type parseDrop struct{}
+
+func (p parseDrop) Handle(d []string, i *Input) bool {
+	if d[0] != "drop" {
+		return false
+	}
+	if len(d) != 3 && len(d) != 4 {
+		i.Error(errors.New(""), "drop expects 2 or 3 arguments")
+	}
+	i.Drop.Height, i.Drop.Restitution = i.num(d[1]), i.num(d[2])
+	if len(d) == 4 {
+		i.Drop.Scatter = i.num(d[3])
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package bounces
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// boxScene returns an input with a w by h box of walls and an elastic ball.
+func boxScene(w, h float64) Input {
+	inp := Input{Error: func(e error, a ...interface{}) {
+		if e != nil {
+			panic(e)
+		}
+	}}
+	inp.Ball, inp.Elasticity = 0.05, 1
+	for _, e := range (Level{Outline: []float64{0, 0, w, 0, w, h, 0, h}}).edges() {
+		inp.Obstacles = append(inp.Obstacles, e)
+	}
+	return inp
+}
+
+// TestFall compares the fall without walls nor scatter with the sum of the
+// hops on the floor.
+func TestFall(t *testing.T) {
+	inp := boxScene(100, 100)
+	inp.Drop = Drop{Height: 0.75, Restitution: 0.5}
+	r := rand.New(rand.NewSource(1))
+	x, y, vx, vy, tf := inp.fall(r, 0.75, 50, 50, 0.5, 0)
+
+	vz := math.Sqrt(2 * gravity * 0.75)
+	e := vz / gravity
+	for vz *= 0.5; vz*vz/(2*gravity) >= minHop; vz *= 0.5 {
+		e += 2 * vz / gravity
+	}
+	t.Log("expected:", e, 50+0.5*e, "got: ", tf, x, y, vx, vy)
+	if math.Abs(tf-e) > 1e-9 || math.Abs(x-50-0.5*e) > 1e-9 || y != 50 || vx != 0.5 || vy != 0 {
+		t.Error()
+	}
+}
+
+// TestFallWall lets the ball hit the walls while in the air, which must keep
+// it in the box.
+func TestFallWall(t *testing.T) {
+	inp := boxScene(1, 1)
+	inp.Drop = Drop{Height: 1, Restitution: 0.3, Scatter: 0.1}
+	r := rand.New(rand.NewSource(1))
+	for k := 0; k < 100; k++ {
+		x, y, _, _, _ := inp.fall(r, 1, 0.9, 0.5, 2, 0.1*r.NormFloat64())
+		if !(Level{Outline: []float64{0.05, 0.05, 0.95, 0.05, 0.95, 0.95, 0.05, 0.95}}).contains(x, y) {
+			t.Log("expected to stay in the box, got: ", x, y)
+			t.Error()
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package bounces
+
+import "math"
+
+// minGrid is the number of obstacles from which a grid is used to find the
+// closest obstacle, below it testing all of them is as fast and leaves the
+// scene to the batch kernel, see BenchmarkCluttered.
+const minGrid = 32
+
+// maxCells limits the number of cells along each side of a grid.
+const maxCells = 256
+
+// grid is a uniform grid over a set of obstacles, each cell listing the
+// obstacles whose bounds, padded by the largest ball, overlap it. The closest
+// obstacle along a path is found by only testing the cells it passes.
+type grid struct {
+	obstacles  []Obstacle
+	pad        float64
+	x, y, size float64
+	nx, ny     int
+	cells      [][]int32
+}
+
+func newGrid(obs []Obstacle, pad float64) *grid {
+	g := &grid{obstacles: obs, pad: pad}
+	x, y, w, h := Input{Obstacles: obs}.bounds()
+	g.x, g.y, w, h = x-pad, y-pad, w+2*pad, h+2*pad
+	g.size = math.Max(w, h) / math.Min(maxCells, math.Ceil(math.Sqrt(float64(len(obs)))))
+	if g.size <= 0 {
+		g.size = 1
+	}
+	g.nx = int(math.Min(maxCells, math.Max(1, math.Ceil(w/g.size))))
+	g.ny = int(math.Min(maxCells, math.Max(1, math.Ceil(h/g.size))))
+	g.cells = make([][]int32, g.nx*g.ny)
+	for oi, o := range obs {
+		x, y, w, h := o.Bounds()
+		x0, y0 := g.cell(x-pad, y-pad)
+		x1, y1 := g.cell(x+w+pad, y+h+pad)
+		for iy := y0; iy <= y1; iy++ {
+			for ix := x0; ix <= x1; ix++ {
+				g.cells[ix+g.nx*iy] = append(g.cells[ix+g.nx*iy], int32(oi))
+			}
+		}
+	}
+	return g
+}
+
+// cell returns the cell containing (x, y), clamped to the grid.
+func (g *grid) cell(x, y float64) (int, int) {
+	ix := int(math.Floor((x - g.x) / g.size))
+	iy := int(math.Floor((y - g.y) / g.size))
+	return clamp(ix, g.nx), clamp(iy, g.ny)
+}
+
+func clamp(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
+
+// closest is closesObstacle using the grid, walking the cells along the path
+// until the closest hit found lies before the cell being left. Ties are
+// resolved as when testing the obstacles in order.
+func (g *grid) closest(x0, y0, vx, vy, r float64) (float64, Obstacle) {
+	// clip the path to the grid
+	t0, t1 := 0.0, math.Inf(1)
+	for _, a := range [2][4]float64{{x0, vx, g.x, float64(g.nx)}, {y0, vy, g.y, float64(g.ny)}} {
+		lo, hi := a[2], a[2]+a[3]*g.size
+		if a[1] == 0 {
+			if a[0] < lo || a[0] > hi {
+				return math.Inf(1), nil
+			}
+			continue
+		}
+		ta, tb := (lo-a[0])/a[1], (hi-a[0])/a[1]
+		t0, t1 = math.Max(t0, math.Min(ta, tb)), math.Min(t1, math.Max(ta, tb))
+	}
+	if t0 > t1 {
+		return math.Inf(1), nil
+	}
+
+	ix, iy := g.cell(x0+vx*t0, y0+vy*t0)
+	sx, tx, dx := g.step(ix, x0, vx, g.x)
+	sy, ty, dy := g.step(iy, y0, vy, g.y)
+	best, hit := math.MaxFloat64, -1
+	for {
+		for _, oi := range g.cells[ix+g.nx*iy] {
+			d, ok := g.obstacles[oi].DistToColl(x0, y0, vx, vy, r)
+			if ok && d > -tol && (d < best || (d == best && int(oi) < hit)) {
+				best, hit = d, int(oi)
+			}
+		}
+		exit := math.Min(tx, ty)
+		if best < exit || exit > t1 {
+			break
+		}
+		if tx < ty {
+			ix, tx = ix+sx, tx+dx
+		} else {
+			iy, ty = iy+sy, ty+dy
+		}
+		if ix < 0 || iy < 0 || ix >= g.nx || iy >= g.ny {
+			break
+		}
+	}
+	if hit < 0 {
+		return math.Inf(1), nil
+	}
+	return math.Max(best, 0) * math.Sqrt(vx*vx+vy*vy), g.obstacles[hit]
+}
+
+// step returns the direction to step the cell index i along one axis, the
+// path parameter at which the cell is left and how much it increases per
+// cell.
+func (g *grid) step(i int, p, v, o float64) (int, float64, float64) {
+	switch {
+	case v > 0:
+		return 1, (o + float64(i+1)*g.size - p) / v, g.size / v
+	case v < 0:
+		return -1, (o + float64(i)*g.size - p) / v, -g.size / v
+	}
+	return 0, math.Inf(1), math.Inf(1)
+}
+
+// index builds a grid for the current obstacles if there are enough of them
+// and they are not placed again for every trajectory, which would cost more
+// than the grid saves.
+func (inp *Input) index() {
+	inp.grid = nil
+	if len(inp.Obstacles) >= minGrid && (len(inp.Jitters) == 0 || inp.JitterBlock) {
+		inp.grid = newGrid(inp.Obstacles, inp.maxBall())
+	}
+}
+
+// indexed returns the grid if it was built for the current obstacles and a
+// ball of radius r.
+func (inp Input) indexed(r float64) *grid {
+	g := inp.grid
+	if g == nil || r > g.pad || len(g.obstacles) != len(inp.Obstacles) || &g.obstacles[0] != &inp.Obstacles[0] {
+		return nil
+	}
+	return g
+}
+
+// maxBall returns the radius of the largest ball not drawn from a
+// distribution.
+func (inp Input) maxBall() float64 {
+	m := inp.Ball
+	for _, o := range inp.Objects {
+		m = math.Max(m, o.Ball)
+	}
+	for _, b := range inp.Balls {
+		m = math.Max(m, b)
+	}
+	return m
+}
@@ -0,0 +1,74 @@
+package bounces
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vron/bounces/line"
+	"github.com/vron/bounces/shape"
+)
+
+// readScene parses the scene in the file p.
+func readScene(t testing.TB, p string) Input {
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	return ParseInput(f, func(e error, a ...interface{}) {
+		if e != nil {
+			t.Fatal(append(a, e)...)
+		}
+	})
+}
+
+// parseScene parses the scene given as text.
+func parseScene(t testing.TB, scene string) Input {
+	return ParseInput(strings.NewReader(scene), func(e error, a ...interface{}) {
+		if e != nil {
+			t.Fatal(append(a, e)...)
+		}
+	})
+}
+
+// throw simulates a single ball thrown with the velocity (vx, vy).
+func throw(inp Input, vx, vy float64) (float64, float64, int) {
+	inp.Velocity = func(r *rand.Rand) (float64, float64) {
+		return vx, vy
+	}
+	inp.index()
+	x, y, l, _ := inp.simulate(rand.New(rand.NewSource(1)))
+	return x, y, l
+}
+
+// clutteredScene returns a room with n obstacles of furniture.
+func clutteredScene(r *rand.Rand, n int) Input {
+	inp := Input{Error: func(e error, a ...interface{}) {}}
+	inp.Ball, inp.Friction, inp.Terminal, inp.Elasticity = 0.05, -0.1, 0.01, 0.5
+	inp.Velocity = func(r *rand.Rand) (float64, float64) {
+		a, v := 2*math.Pi*r.Float64(), math.Exp(r.NormFloat64()*0.75+0.5)
+		return v * math.Cos(a), v * math.Sin(a)
+	}
+	inp.Start = [2]float64{10, 10}
+	for _, e := range (Level{Outline: []float64{0, 0, 20, 0, 20, 20, 0, 20}}).edges() {
+		inp.Obstacles = append(inp.Obstacles, e, shape.NewCircle(e[0], e[1], 0))
+	}
+	for len(inp.Obstacles) < n {
+		x, y := 20*r.Float64(), 20*r.Float64()
+		if math.Hypot(x-10, y-10) < 1 {
+			continue
+		}
+		if r.Intn(2) == 0 {
+			inp.Obstacles = append(inp.Obstacles, shape.NewCircle(x, y, 0.1*r.Float64()))
+			continue
+		}
+		a := 2 * math.Pi * r.Float64()
+		x1, y1 := x+0.3*math.Cos(a), y+0.3*math.Sin(a)
+		inp.Obstacles = append(inp.Obstacles, line.SegmentFromPoints(x, y, x1, y1),
+			shape.NewCircle(x, y, 0), shape.NewCircle(x1, y1, 0))
+	}
+	return inp
+}
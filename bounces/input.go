@@ -2,7 +2,9 @@ package bounces
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"math"
@@ -10,8 +12,10 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/vron/bounces/line"
+	"github.com/vron/bounces/material"
 	"github.com/vron/bounces/shape"
 )
 
@@ -24,24 +28,100 @@ type Obstacle interface {
 }
 
 type Input struct {
-	Ball       float64
+	Object
 	Start      [2]float64
-	Velocity   VelocitySampler
-	Friction   float64
-	Terminal   float64
-	Elasticity float64
+	StartLevel int
+	Drop       Drop
 	Measures   []Rect
 
+	// Levels are raised surfaces, Layers holds the levels each obstacle
+	// exists on as a bit mask with bit 0 being the floor, 0 meaning all.
+	Levels []Level
+	Layers []uint64
+
+	// Rooms are connected by Doors, each room is reported as a measure.
+	Rooms []Room
+	Doors []line.Segment
+
+	// Wander is the variance, in rad² per unit of distance, of the random
+	// change of direction while rolling, Seams kick it at distinct lines.
+	Wander float64
+	Seams  []Seam
+
+	// Materials, by name, replace the elasticity for obstacles made of them
+	// with the square of their coefficient of restitution.
+	Materials map[string]material.Restitution
+
+	// Objects, if given, replaces Object with a mixture of object types.
+	Objects []Object
+
+	// Balls holds the radius of each ball when more than one ball is
+	// simulated at once, BallElasticity is used for ball-ball collisions.
+	// If there are several Objects the radius is instead taken from the
+	// object drawn for each ball.
+	Balls          []float64
+	BallElasticity float64
+
 	ImageRes  int
 	ImagePath string
 	Error     func(e error, a ...interface{})
 
+	// Workers is the number of trajectories simulated in parallel by Run,
+	// runtime.NumCPU() if 0.
+	Workers int
+	// Seed determines all trajectories, the results being the same for the
+	// same Seed whatever the number of workers.
+	Seed int64
+	// Batch makes Run use the batch kernel for the scenes it can simulate.
+	Batch bool
+	// Replicates is the number of independent runs, 5 if 0, Run reports
+	// intervals at the level Confidence, 0.95 if 0, computed by Interval.
+	Replicates int
+	Confidence float64
+	Interval   Interval
+
+	// Checkpoint is the file Run saves its state to, every CheckpointEvery
+	// and when it stops, and continues from if Resume is set and the file
+	// exists. Hash identifies the scene the input was parsed from, a run is
+	// only resumed for the same scene.
+	Checkpoint      string
+	CheckpointEvery time.Duration
+	Resume          bool
+	Hash            string
+	// BlockTimeout is how long Coordinate waits for a remote worker to
+	// simulate a block before handing it to another, 10 minutes if 0.
+	BlockTimeout time.Duration
+
 	Obstacles []Obstacle
+	// Jitters are re-sampled for each trajectory, or only once per block of
+	// trajectories if JitterBlock is set.
+	Jitters     []Jitter
+	JitterBlock bool
+	Movers      []MovingObstacle
+
+	groups []int
+	// Check makes Run verify physical invariants along every trajectory,
+	// reporting the violations in the results.
+	Check bool
+	check checker
+
+	// LogMeasure names a measure, Run listing the trajectories ending in it
+	// in the results. trace, if set, is given the events of the trajectories
+	// simulated.
+	LogMeasure string
+	trace      func(Event)
+
+	// grid speeds up finding the closest obstacle
+	grid *grid
 }
 
+// A Rect is a measure, if Level is given the ball must also have stopped on
+// that level.
 type Rect struct {
 	X, Y, W, H float64
 	Name       string
+	Level      string
+	Target     Target
 }
 
 type Parser interface {
@@ -52,10 +132,12 @@ func ParseInput(r io.Reader, fatal func(e error, a ...interface{})) Input {
 	buf, err := ioutil.ReadAll(r)
 	fatal(err, "error reading input:")
 
-	inp := Input{Error: fatal}
+	inp := Input{Error: fatal, BallElasticity: -1, Hash: fmt.Sprintf("%x", sha256.Sum256(buf))}
 	lines := bytes.Split(buf, []byte("\n"))
 	parsers := []Parser{
 		parseBall{},
+		parseBalls{},
+		parseBallElasticity{},
 		parseLine{},
 		parseCircle{},
 		parseStart{},
@@ -64,6 +146,16 @@ func ParseInput(r io.Reader, fatal func(e error, a ...interface{})) Input {
 		parseTerminal{},
 		parseElasticity{},
 		parseMeasure{},
+		parseObject{},
+		parseInertia{},
+		parseGroup{},
+		parseJitter{},
+		parseCurl{},
+		parseDrop{},
+		parseLevel{},
+		parseRoom{},
+		parseWander{},
+		parseMaterial{},
 	}
 Lines:
 	for _, l := range lines {
@@ -82,9 +174,50 @@ Lines:
 		fatal(errors.New("unknown command: '" + string(l) + "'"))
 	}
 
-	if inp.Measures == nil || len(inp.Measures) < 1 {
+	if len(inp.Measures) < 1 && len(inp.Rooms) < 1 {
 		fatal(errors.New("must have a measure for convergence"))
 	}
+	if len(inp.groups) > 0 {
+		fatal(errors.New("group without end"))
+	}
+	if len(inp.Movers) > 0 && len(inp.Balls) > 1 {
+		fatal(errors.New("moving obstacles are not supported with several balls"))
+	}
+	if inp.Drop.Height > 0 && len(inp.Balls) > 1 {
+		fatal(errors.New("drop is not supported with several balls"))
+	}
+	if len(inp.Levels) > 0 && len(inp.Balls) > 1 {
+		fatal(errors.New("levels are not supported with several balls"))
+	}
+	for _, r := range inp.Rooms {
+		if r.Friction != 1 && len(inp.Balls) > 1 {
+			fatal(errors.New("room friction is not supported with several balls"))
+		}
+	}
+	inp.roomWalls()
+	objects := inp.Objects
+	if len(objects) == 0 {
+		objects = []Object{inp.Object}
+	}
+	for _, o := range objects {
+		if o.Velocity == nil {
+			fatal(errors.New(""), "object '"+o.Name+"' has no velocity")
+		}
+		if o.curls() && (len(inp.Movers) > 0 || len(inp.Balls) > 1) {
+			fatal(errors.New("curl is not supported with moving obstacles or several balls"))
+		}
+	}
+	for bi := range inp.Balls {
+		if inp.Balls[bi] == 0 {
+			inp.Balls[bi] = inp.Ball
+		}
+	}
+	if len(inp.Balls) == 1 {
+		inp.Ball, inp.Balls = inp.Balls[0], nil
+	}
+	if inp.BallElasticity < 0 {
+		inp.BallElasticity = inp.Elasticity
+	}
 
 	return inp
 }
@@ -104,11 +237,14 @@ func (p parseStart) Handle(d []string, i *Input) bool {
 	if d[0] != "start" {
 		return false
 	}
-	if len(d) != 3 {
-		i.Error(errors.New(""), "start expects 2 arguments")
+	if len(d) != 3 && len(d) != 4 {
+		i.Error(errors.New(""), "start expects 2 or 3 arguments")
 	}
 	i.Start[0] = i.num(d[1])
 	i.Start[1] = i.num(d[2])
+	if len(d) == 4 {
+		i.StartLevel = i.level(d[3])
+	}
 	return true
 }
 
@@ -124,14 +260,14 @@ func (p parseVelocity) Handle(d []string, i *Input) bool {
 	switch d[1] {
 	case "uniform":
 		l, h := i.num(d[2]), i.num(d[3])
-		i.Velocity = func(r *rand.Rand) (float64, float64) {
+		i.object().Velocity = func(r *rand.Rand) (float64, float64) {
 			theta := r.Float64() * math.Pi * 2
 			v := r.Float64()*(h-l) + l
 			return math.Cos(theta) * v, math.Sin(theta) * v
 		}
 	case "lognormal":
 		mu, sig, lim := i.num(d[2]), i.num(d[3]), i.num(d[4])
-		i.Velocity = func(r *rand.Rand) (float64, float64) {
+		i.object().Velocity = func(r *rand.Rand) (float64, float64) {
 			theta := r.Float64() * math.Pi * 2
 			v := 1e99
 			for v > lim {
@@ -151,10 +287,43 @@ func (p parseBall) Handle(d []string, i *Input) bool {
 	if d[0] != "ball" {
 		return false
 	}
+	o := i.object()
+	i.param(d, &o.Ball, &o.BallDist)
+	return true
+}
+
+type parseBalls struct{}
+
+func (p parseBalls) Handle(d []string, i *Input) bool {
+	if d[0] != "balls" {
+		return false
+	}
+	if len(d) < 2 {
+		i.Error(errors.New(""), "balls expects at least 1 argument")
+	}
+	n := int(i.num(d[1]))
+	if n < 1 || (len(d) != 2 && len(d) != n+2) {
+		i.Error(errors.New(""), "balls expects a count and optionally one radius per ball")
+	}
+	i.Balls = make([]float64, n)
+	for bi := range i.Balls {
+		if len(d) > 2 {
+			i.Balls[bi] = i.num(d[bi+2])
+		}
+	}
+	return true
+}
+
+type parseBallElasticity struct{}
+
+func (p parseBallElasticity) Handle(d []string, i *Input) bool {
+	if d[0] != "ballelasticity" {
+		return false
+	}
 	if len(d) != 2 {
-		i.Error(errors.New(""), "ball expects 1 argument")
+		i.Error(errors.New(""), "ballelasticity expects 1 arguments")
 	}
-	i.Ball = i.num(d[1])
+	i.BallElasticity = i.num(d[1])
 	return true
 }
 
@@ -164,12 +333,15 @@ func (p parseLine) Handle(d []string, i *Input) bool {
 	if d[0] != "line" {
 		return false
 	}
+	from := len(i.Obstacles)
+	d, opts := splitOptions(d)
 	if len(d) != 5 {
 		i.Error(errors.New(""), "line expects 4 arguments")
 	}
 	i.Obstacles = append(i.Obstacles, line.SegmentFromPoints(i.num(d[1]), i.num(d[2]), i.num(d[3]), i.num(d[4])))
 	i.Obstacles = append(i.Obstacles, shape.NewCircle(i.num(d[3]), i.num(d[4]), 0))
 	i.Obstacles = append(i.Obstacles, shape.NewCircle(i.num(d[1]), i.num(d[2]), 0))
+	i.options(opts, from)
 	return true
 }
 
@@ -179,23 +351,65 @@ func (p parseCircle) Handle(d []string, i *Input) bool {
 	if d[0] != "circle" {
 		return false
 	}
+	from := len(i.Obstacles)
+	d, opts := splitOptions(d)
 	if len(d) != 4 {
 		i.Error(errors.New(""), "circle expects 3 arguments")
 	}
 	i.Obstacles = append(i.Obstacles, shape.NewCircle(i.num(d[1]), i.num(d[2]), i.num(d[3])))
+	i.options(opts, from)
 	return true
 }
 
+// splitOptions splits the trailing options of an obstacle definition, e.g.
+// 'jitter 0.1' or 'on table', from its arguments. The options are keyed by
+// their name and include it.
+func splitOptions(d []string) ([]string, map[string][]string) {
+	opts := map[string][]string{}
+	rest, last := d, ""
+	for k, w := range d {
+		switch w {
+		case "jitter", "move", "swing", "on", "material":
+			if last == "" {
+				rest = d[:k]
+			}
+			last = w
+			opts[w] = []string{}
+		}
+		if last != "" {
+			opts[last] = append(opts[last], w)
+		}
+	}
+	return rest, opts
+}
+
+// options applies the options of an obstacle definition to the obstacles
+// added since from.
+func (i *Input) options(opts map[string][]string, from int) {
+	mask := i.levelMask(opts["on"])
+	for len(i.Layers) < len(i.Obstacles) {
+		i.Layers = append(i.Layers, mask)
+	}
+	i.coat(opts["material"], from)
+	i.jitter(opts["jitter"], from)
+	if opts["move"] != nil && opts["swing"] != nil {
+		i.Error(errors.New(""), "an obstacle can not both move and swing")
+	}
+	if opts["material"] != nil && (opts["move"] != nil || opts["swing"] != nil) {
+		i.Error(errors.New(""), "moving obstacles can not have a material")
+	}
+	i.motion(opts["move"], from)
+	i.motion(opts["swing"], from)
+}
+
 type parseFriction struct{}
 
 func (p parseFriction) Handle(d []string, i *Input) bool {
 	if d[0] != "friction" {
 		return false
 	}
-	if len(d) != 2 {
-		i.Error(errors.New(""), "friction expects 1 arguments")
-	}
-	i.Friction = i.num(d[1])
+	o := i.object()
+	i.param(d, &o.Friction, &o.FrictionDist)
 	return true
 }
 
@@ -205,10 +419,8 @@ func (p parseTerminal) Handle(d []string, i *Input) bool {
 	if d[0] != "terminal" {
 		return false
 	}
-	if len(d) != 2 {
-		i.Error(errors.New(""), "terminal expects 1 arguments")
-	}
-	i.Terminal = i.num(d[1])
+	o := i.object()
+	i.param(d, &o.Terminal, &o.TerminalDist)
 	return true
 }
 
@@ -218,10 +430,8 @@ func (p parseElasticity) Handle(d []string, i *Input) bool {
 	if d[0] != "elasticity" {
 		return false
 	}
-	if len(d) != 2 {
-		i.Error(errors.New(""), "elasticity expects 1 arguments")
-	}
-	i.Elasticity = i.num(d[1])
+	o := i.object()
+	i.param(d, &o.Elasticity, &o.ElasticityDist)
 	return true
 }
 
@@ -231,13 +441,65 @@ func (p parseMeasure) Handle(d []string, i *Input) bool {
 	if d[0] != "measure" {
 		return false
 	}
-	if len(d) != 6 {
-		i.Error(errors.New(""), "meassure expects 5 arguments")
+	d, t := i.target(d)
+	if len(d) != 6 && len(d) != 7 {
+		i.Error(errors.New(""), "meassure expects 5 or 6 arguments")
 	}
-	i.Measures = append(i.Measures, Rect{i.num(d[2]), i.num(d[3]), i.num(d[4]) - i.num(d[2]), i.num(d[5]) - i.num(d[3]), d[1]})
+	r := Rect{i.num(d[2]), i.num(d[3]), i.num(d[4]) - i.num(d[2]), i.num(d[5]) - i.num(d[3]), d[1], "", t}
+	if len(d) == 7 {
+		r.Level = i.levelName(i.level(d[6]))
+	}
+	i.Measures = append(i.Measures, r)
 	return true
 }
 
+// target parses the options 'precision p', 'rel p' and 'report' ending a
+// measure, returning the arguments before them.
+func (i *Input) target(d []string) ([]string, Target) {
+	t, n := Target{}, len(d)
+	for k := len(d) - 1; k >= 6; k-- {
+		switch d[k] {
+		case "precision", "rel":
+			if k+1 >= len(d) {
+				i.Error(errors.New(""), d[k]+" expects a value")
+			}
+			n = k
+		case "report":
+			n = k
+		}
+	}
+	for k := n; k < len(d); k++ {
+		switch d[k] {
+		case "precision":
+			t.Precision = i.percent(d[k+1])
+			k++
+		case "rel":
+			t.Relative = i.percent(d[k+1])
+			k++
+		case "report":
+			t.ReportOnly = true
+		default:
+			i.Error(errors.New(""), "unknown measure option: '"+d[k]+"'")
+		}
+	}
+	return d[:n], t
+}
+
+// percent parses a number, given as a fraction or in percent as 5%.
+func (i *Input) percent(b string) float64 {
+	if strings.HasSuffix(b, "%") {
+		return i.num(strings.TrimSuffix(b, "%")) / 100
+	}
+	return i.num(b)
+}
+
+func (i Input) ballCount() int {
+	if len(i.Balls) > 1 {
+		return len(i.Balls)
+	}
+	return 1
+}
+
 func (i *Input) num(b string) float64 {
 	f, err := strconv.ParseFloat(b, 64)
 	i.Error(err, "parsing i.number")
@@ -0,0 +1,167 @@
+package bounces
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/gonum/stat"
+)
+
+// An Interval is a method to compute the confidence interval of a measure.
+type Interval int
+
+const (
+	// BatchMeans uses the Student t interval of the means of the
+	// replicates, or Wilson if they are all the same.
+	BatchMeans Interval = iota
+	// Wilson uses the Wilson score interval of all trajectories.
+	Wilson
+	// ClopperPearson uses the exact binomial interval of all trajectories,
+	// conservative also for probabilities close to 0 or 1.
+	ClopperPearson
+)
+
+var intervalNames = []string{"batch means", "Wilson", "Clopper-Pearson"}
+
+func (iv Interval) String() string {
+	return intervalNames[iv]
+}
+
+// ParseInterval returns the interval method named s, ignoring case, spaces
+// and dashes.
+func ParseInterval(s string) (Interval, error) {
+	norm := func(s string) string {
+		return strings.NewReplacer(" ", "", "-", "").Replace(strings.ToLower(s))
+	}
+	for iv, n := range intervalNames {
+		if norm(n) == norm(s) {
+			return Interval(iv), nil
+		}
+	}
+	return 0, errors.New("unknown interval method: '" + s + "'")
+}
+
+// bounds returns the estimate and the interval, at the confidence level c,
+// for the hits among cases counted by each replicate.
+func (iv Interval) bounds(c float64, hits, cases []int64) (float64, float64, float64) {
+	if iv == BatchMeans {
+		vals := make([]float64, 0, len(hits))
+		for i := range hits {
+			if cases[i] > 0 {
+				vals = append(vals, float64(hits[i])/float64(cases[i]))
+			}
+		}
+		m := stat.Mean(vals, nil)
+		if len(vals) < 2 {
+			return m, 0, 1
+		}
+		e := stat.StdErr(stat.StdDev(vals, nil), float64(len(vals)))
+		if e == 0 {
+			// the replicates agree, e.g. none hit a rare measure, which
+			// does not make the measure exact
+			return Wilson.bounds(c, hits, cases)
+		}
+		w := studentQuantile((1+c)/2, float64(len(vals)-1)) * e
+		return m, math.Max(0, m-w), math.Min(1, m+w)
+	}
+
+	var x, n float64
+	for i := range hits {
+		x, n = x+float64(hits[i]), n+float64(cases[i])
+	}
+	if n == 0 {
+		return math.NaN(), 0, 1
+	}
+	p, a := x/n, 1-c
+	if iv == Wilson {
+		z := normalQuantile(1 - a/2)
+		d := 1 + z*z/n
+		mid := (p + z*z/(2*n)) / d
+		w := z / d * math.Sqrt(p*(1-p)/n+z*z/(4*n*n))
+		return p, math.Max(0, mid-w), math.Min(1, mid+w)
+	}
+	lo, hi := 0.0, 1.0
+	if x > 0 {
+		lo = betaQuantile(a/2, x, n-x+1)
+	}
+	if x < n {
+		hi = betaQuantile(1-a/2, x+1, n-x)
+	}
+	return p, lo, hi
+}
+
+func normalQuantile(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
+
+// studentQuantile returns the p quantile, p >= 0.5, of the Student t
+// distribution with nu degrees of freedom.
+func studentQuantile(p, nu float64) float64 {
+	// P(T > t) = I(nu/(nu+t²); nu/2, 1/2)/2
+	u := betaQuantile(2*(1-p), nu/2, 0.5)
+	return math.Sqrt(nu * (1 - u) / u)
+}
+
+// betaQuantile returns the p quantile of the beta distribution, found by
+// bisection.
+func betaQuantile(p, a, b float64) float64 {
+	lo, hi := 0.0, 1.0
+	for i := 0; i < 100 && hi-lo > 1e-15; i++ {
+		m := (lo + hi) / 2
+		if incBeta(m, a, b) < p {
+			lo = m
+		} else {
+			hi = m
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// incBeta returns the regularized incomplete beta function I(x; a, b),
+// evaluated by its continued fraction.
+func incBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	if x > (a+1)/(a+b+2) {
+		return 1 - incBeta(1-x, b, a)
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab-la-lb+a*math.Log(x)+b*math.Log(1-x)) / a
+
+	// Lentz's method
+	const tiny = 1e-300
+	f, c, d := 1.0, 1.0, 0.0
+	for i := 0; i <= 300; i++ {
+		m := float64(i / 2)
+		var num float64
+		switch {
+		case i == 0:
+			num = 1
+		case i%2 == 0:
+			num = m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		default:
+			num = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		}
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		d = 1 / d
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		f *= c * d
+		if math.Abs(1-c*d) < 1e-15 {
+			return front * (f - 1)
+		}
+	}
+	return front * (f - 1)
+}
@@ -0,0 +1,46 @@
+package bounces
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuantiles(t *testing.T) {
+	quantile(t, 1.959963985, normalQuantile(0.975))
+	quantile(t, 2.776445105, studentQuantile(0.975, 4))
+	quantile(t, 12.70620474, studentQuantile(0.975, 1))
+	quantile(t, 0.5, betaQuantile(0.5, 3, 3))
+	quantile(t, 0.0362166720, betaQuantile(0.975, 1, 100))
+}
+
+func quantile(t *testing.T, e, a float64) {
+	t.Log("expected:", e, "got: ", a)
+	if math.Abs(a-e) > 1e-6 {
+		t.Error()
+	}
+}
+
+func TestIntervals(t *testing.T) {
+	interval(t, Wilson, 0, []int64{0}, []int64{100},
+		0, 0.0369935)
+	interval(t, ClopperPearson, 0, []int64{0}, []int64{100},
+		0, 0.0362167)
+	interval(t, ClopperPearson, 0.5, []int64{30, 20}, []int64{50, 50},
+		0.3983, 0.6017)
+	interval(t, Wilson, 0.5, []int64{30, 20}, []int64{50, 50},
+		0.4038, 0.5962)
+	interval(t, BatchMeans, 0.5, []int64{50, 60, 40, 55, 45}, []int64{100, 100, 100, 100, 100},
+		0.5-2.776445*0.0353553, 0.5+2.776445*0.0353553)
+	// no spread between the replicates, falling back to Wilson
+	interval(t, BatchMeans, 0, []int64{0, 0, 0}, []int64{10, 10, 10},
+		0, 0.1135134)
+}
+
+func interval(t *testing.T, iv Interval, m float64, hits, cases []int64, lo, hi float64) {
+	a, b, c := iv.bounds(0.95, hits, cases)
+
+	t.Log("expected:", m, lo, hi, "got: ", a, b, c)
+	if math.Abs(a-m) > 1e-4 || math.Abs(b-lo) > 1e-4 || math.Abs(c-hi) > 1e-4 {
+		t.Error()
+	}
+}
@@ -0,0 +1,153 @@
+package bounces
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// maxJitter is the largest offset and angle drawn by a jitter, in standard
+// deviations, such that the obstacles stay within their bounds.
+const maxJitter = 3
+
+// A Jitter makes the placement of the obstacles [From, To) uncertain. They
+// are moved rigidly by a normal distributed offset with standard deviation
+// Pos and rotated around (X, Y) by an angle with standard deviation Rot.
+type Jitter struct {
+	From, To int
+	Pos, Rot float64
+	X, Y     float64
+}
+
+// widen returns the box b grown to hold all places the jitter can move it
+// to, a rotation by theta moving a point at most min(theta, 2) times its
+// distance from the center.
+func (j Jitter) widen(b [4]float64) [4]float64 {
+	rho := 0.0
+	for _, x := range [2]float64{b[0], b[2]} {
+		for _, y := range [2]float64{b[1], b[3]} {
+			rho = math.Max(rho, math.Hypot(x-j.X, y-j.Y))
+		}
+	}
+	e := maxJitter*j.Pos + rho*math.Min(maxJitter*j.Rot, 2)
+	return [4]float64{b[0] - e, b[1] - e, b[2] + e, b[3] + e}
+}
+
+// placeObstacles returns a new set of obstacles with all jitters applied,
+// the obstacles of the input are left untouched such that it can be done
+// concurrently. A jitter moving its obstacles over the start is drawn again,
+// up to maxRedraws times before leaving them where they are.
+func (inp Input) placeObstacles(r *rand.Rand) []Obstacle {
+	obs := make([]Obstacle, len(inp.Obstacles))
+	copy(obs, inp.Obstacles)
+	for _, j := range inp.Jitters {
+		dx, dy, theta := 0.0, 0.0, 0.0
+		for k := 0; k < maxRedraws; k++ {
+			x, y := truncNorm(r)*j.Pos, truncNorm(r)*j.Pos
+			a := truncNorm(r) * j.Rot
+			if !inp.crosses(obs[j.From:j.To], j, x, y, a) {
+				dx, dy, theta = x, y, a
+				break
+			}
+		}
+		for oi := j.From; oi < j.To; oi++ {
+			obs[oi] = move(obs[oi], dx, dy, theta, j.X, j.Y)
+		}
+	}
+	return obs
+}
+
+// crosses returns whether moving the obstacles as the jitter j by (dx, dy)
+// and theta sweeps them over the ball at the start, i.e. whether the start
+// moves through them as seen from the obstacles.
+func (inp Input) crosses(obs []Obstacle, j Jitter, dx, dy, theta float64) bool {
+	x, y := inp.Start[0], inp.Start[1]
+	sin, cos := math.Sincos(-theta)
+	x0, y0 := x-dx-j.X, y-dy-j.Y
+	vx, vy := j.X+cos*x0-sin*y0-x, j.Y+sin*x0+cos*y0-y
+	if vx == 0 && vy == 0 {
+		return false
+	}
+	for _, o := range obs {
+		if d, ok := o.DistToColl(x, y, vx, vy, inp.Ball); ok && d > -tol && d <= 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// truncNorm draws a standard normal number, drawing again any beyond
+// maxJitter.
+func truncNorm(r *rand.Rand) float64 {
+	for {
+		if z := r.NormFloat64(); math.Abs(z) <= maxJitter {
+			return z
+		}
+	}
+}
+
+// jitter adds a jitter, as split of by splitOptions, to the obstacles added
+// since from.
+func (i *Input) jitter(d []string, from int) {
+	if len(d) == 0 {
+		return
+	}
+	if len(d) != 2 && len(d) != 3 {
+		i.Error(errors.New(""), "jitter expects 1 or 2 arguments")
+	}
+	j := Jitter{From: from, To: len(i.Obstacles), Pos: i.num(d[1])}
+	if len(d) == 3 {
+		j.Rot = i.num(d[2])
+	}
+	j.X, j.Y = i.center(from, j.To)
+	i.Jitters = append(i.Jitters, j)
+}
+
+func (i *Input) center(from, to int) (float64, float64) {
+	inp := Input{Obstacles: i.Obstacles[from:to]}
+	x, y, w, h := inp.bounds()
+	return x + w/2, y + h/2
+}
+
+type parseGroup struct{}
+
+// Handle takes care of 'group' which starts a set of obstacles, ended by
+// 'end jitter pos [rot]', that are to be jittered together.
+func (p parseGroup) Handle(d []string, i *Input) bool {
+	switch d[0] {
+	case "group":
+		if len(d) != 1 {
+			i.Error(errors.New(""), "group expects no arguments")
+		}
+		i.groups = append(i.groups, len(i.Obstacles))
+	case "end":
+		if len(i.groups) == 0 {
+			i.Error(errors.New(""), "end without group")
+		}
+		from := i.groups[len(i.groups)-1]
+		i.groups = i.groups[:len(i.groups)-1]
+		d, opts := splitOptions(d)
+		if len(d) != 1 || len(opts) > 1 || (len(opts) == 1 && opts["jitter"] == nil) {
+			i.Error(errors.New(""), "end expects only a jitter")
+		}
+		i.jitter(opts["jitter"], from)
+	default:
+		return false
+	}
+	return true
+}
+
+type parseJitter struct{}
+
+// Handle takes care of 'jitter block', re-placing the obstacles only once for
+// every block of simulations instead of for every trajectory.
+func (p parseJitter) Handle(d []string, i *Input) bool {
+	if d[0] != "jitter" {
+		return false
+	}
+	if len(d) != 2 || (d[1] != "block" && d[1] != "trajectory") {
+		i.Error(errors.New(""), "jitter expects 'block' or 'trajectory'")
+	}
+	i.JitterBlock = d[1] == "block"
+	return true
+}
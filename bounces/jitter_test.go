@@ -0,0 +1,164 @@
+package bounces
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vron/bounces/line"
+)
+
+// jitteredRoom is a room whose walls are jittered together.
+const jitteredRoom = `ball 0.05
+velocity lognormal 0.5 0.75 4
+start 2.5 1.5
+friction -0.1
+terminal 0.01
+elasticity 0.5
+
+group
+line 0 0 5 0
+line 5 0 5 3
+line 5 3 0 3
+line 0 3 0 0
+end jitter 0.2 0
+
+measure all 0 0 5 3
+`
+
+// TestJitterBounds runs a scene where the balls stop outside of the
+// unjittered walls, which must still be within the image.
+func TestJitterBounds(t *testing.T) {
+	inp := parseScene(t, jitteredRoom)
+	inp.ImageRes = 64
+	x, y, w, h := inp.bounds()
+	t.Log("expected beyond:", 0, 0, 5, 3, "got: ", x, y, x+w, y+h)
+	if x > -0.6+tol || y > -0.6+tol || x+w < 5.6-tol || y+h < 3.6-tol {
+		t.Error()
+	}
+
+	res := Run(inp, 0, 20000, 20000)
+	sum := int64(0)
+	for _, c := range res.Image {
+		sum += int64(c)
+	}
+	t.Log("expected:", res.Samples, "got: ", sum)
+	if sum != res.Samples {
+		t.Error()
+	}
+}
+
+// TestJitterStart places walls that are as far from the start as they are
+// jittered, which must not move them past it.
+func TestJitterStart(t *testing.T) {
+	inp := parseScene(t, strings.Replace(jitteredRoom, "start 2.5 1.5", "start 0.3 0.3", 1))
+	r := rand.New(rand.NewSource(1))
+	for k := 0; k < 10000; k++ {
+		var outline []float64
+		for _, o := range inp.placeObstacles(r) {
+			if s, ok := o.(line.Segment); ok {
+				outline = append(outline, s[0], s[1])
+			}
+		}
+		if !(Level{Outline: outline}).contains(0.3, 0.3) {
+			t.Log("expected the start within", outline)
+			t.FailNow()
+		}
+	}
+	inp.ImageRes = 64
+	res := Run(inp, 0, 20000, 20000)
+	sum := int64(0)
+	for _, c := range res.Image {
+		sum += int64(c)
+	}
+	t.Log("expected:", res.Samples, "got: ", sum)
+	if sum != res.Samples {
+		t.Error()
+	}
+}
+
+// TestJitterRotate rotates the room around its center, keeping the
+// distance of every corner from it.
+func TestJitterRotate(t *testing.T) {
+	inp := parseScene(t, strings.Replace(jitteredRoom, "jitter 0.2 0", "jitter 0 0.1", 1))
+	j := inp.Jitters[0]
+	t.Log("expected:", 2.5, 1.5, "got: ", j.X, j.Y)
+	if j.X != 2.5 || j.Y != 1.5 {
+		t.Error()
+	}
+	r := rand.New(rand.NewSource(1))
+	for k := 0; k < 100; k++ {
+		obs := inp.placeObstacles(r)
+		for i, o := range obs {
+			s, ok := o.(line.Segment)
+			if !ok {
+				continue
+			}
+			s0 := inp.Obstacles[i].(line.Segment)
+			d0, d := math.Hypot(s0[0]-2.5, s0[1]-1.5), math.Hypot(s[0]-2.5, s[1]-1.5)
+			if math.Abs(d-d0) > 1e-9 {
+				t.Log("expected:", d0, "got: ", d)
+				t.Error()
+			}
+		}
+	}
+}
+
+// TestJitterResample throws a ball straight at a jittered wall, which is
+// placed again for every trajectory unless it is placed once per block.
+func TestJitterResample(t *testing.T) {
+	for _, block := range []bool{false, true} {
+		inp := parseScene(t, jitteredRoom)
+		inp.JitterBlock = block
+		inp.Velocity = func(r *rand.Rand) (float64, float64) {
+			return 1, 0
+		}
+		walls := map[float64]bool{}
+		inp.trace = func(e Event) {
+			if e.Kind == "bounce" && len(walls) < 100 {
+				walls[e.X] = true
+			}
+		}
+		r := rand.New(rand.NewSource(1))
+		if block {
+			inp.Obstacles = inp.placeObstacles(r)
+		}
+		o := inp.newOutcome()
+		for k := 0; k < 10; k++ {
+			inp.trajectory(r, &o)
+		}
+		t.Log("expected new walls:", !block, "got: ", len(walls), "bounce places")
+		if (len(walls) > 1) == block {
+			t.Error()
+		}
+	}
+}
+
+// TestJitterShared places the obstacles from many workers at once, none of
+// which may change those of the input.
+func TestJitterShared(t *testing.T) {
+	inp := parseScene(t, jitteredRoom)
+	obs := append([]Obstacle(nil), inp.Obstacles...)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			for k := 0; k < 1000; k++ {
+				inp.placeObstacles(r)
+			}
+		}(w)
+	}
+	wg.Wait()
+	inp.Workers, inp.ImageRes = 8, 64
+	Run(inp, 0, 20000, 20000)
+	for i, o := range obs {
+		if inp.Obstacles[i] != o {
+			t.Log("expected:", o, "got: ", inp.Obstacles[i])
+			t.Error()
+		}
+	}
+}
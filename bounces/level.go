@@ -0,0 +1,220 @@
+package bounces
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/vron/bounces/line"
+)
+
+// A Level is a raised surface, e.g. a table top or a step, at Height above
+// the floor. Outline is the polygon x0 y0 x1 y1 ... bounding it, a ball
+// rolling over its edge falls to the highest level below it.
+type Level struct {
+	Name    string
+	Height  float64
+	Outline []float64
+}
+
+// floor is the name of the implicit level 0, the levels of the input being
+// numbered from 1.
+const floor = "floor"
+
+// edgeStep is how far beyond an edge the level below is looked for.
+const edgeStep = 100 * tol
+
+func (l Level) edges() []line.Segment {
+	n := len(l.Outline) / 2
+	es := make([]line.Segment, n)
+	for k := range es {
+		j := (k + 1) % n
+		es[k] = line.SegmentFromPoints(l.Outline[2*k], l.Outline[2*k+1], l.Outline[2*j], l.Outline[2*j+1])
+	}
+	return es
+}
+
+func (l Level) contains(x, y float64) bool {
+	in, n := false, len(l.Outline)/2
+	for k := 0; k < n; k++ {
+		j := (k + n - 1) % n
+		x0, y0, x1, y1 := l.Outline[2*k], l.Outline[2*k+1], l.Outline[2*j], l.Outline[2*j+1]
+		if (y0 > y) != (y1 > y) && x < (x1-x0)*(y-y0)/(y1-y0)+x0 {
+			in = !in
+		}
+	}
+	return in
+}
+
+func (inp Input) height(l int) float64 {
+	if l == 0 {
+		return 0
+	}
+	return inp.Levels[l-1].Height
+}
+
+func (inp Input) levelName(l int) string {
+	if l == 0 {
+		return floor
+	}
+	return inp.Levels[l-1].Name
+}
+
+// levelAt returns the highest level not above h which contains (x, y).
+func (inp Input) levelAt(x, y, h float64) int {
+	best := 0
+	for li, l := range inp.Levels {
+		if l.Height <= h && l.Height > inp.height(best) && l.contains(x, y) {
+			best = li + 1
+		}
+	}
+	return best
+}
+
+// onLevel returns the obstacles of all, the full list of obstacles matching
+// the layers, existing on level l.
+func (inp Input) onLevel(all []Obstacle, l int) []Obstacle {
+	if len(inp.Levels) == 0 {
+		return all
+	}
+	obs := []Obstacle{}
+	for oi, o := range all {
+		if m := inp.Layers[oi]; m == 0 || m&(1<<uint(l)) != 0 {
+			obs = append(obs, o)
+		}
+	}
+	return obs
+}
+
+// levelEdge returns the distance along the path, curving with k, at which
+// the ball rolls over the edge of the level l, or +Inf.
+func (inp Input) levelEdge(l int, x, y, vx, vy, k float64) float64 {
+	if l == 0 {
+		return math.Inf(1)
+	}
+	d, _ := crossing(inp.Levels[l-1].edges(), x, y, vx, vy, k)
+	return d
+}
+
+// crossing returns the distance along the path, curving with k, at which the
+// center of the ball first crosses one of the segments, and its index, or
+// +Inf and -1.
+func crossing(segs []line.Segment, x, y, vx, vy, k float64) (float64, int) {
+	closest, ci := math.Inf(1), -1
+	v := math.Sqrt(vx*vx + vy*vy)
+	for si, s := range segs {
+		d, ok := 0.0, false
+		if k != 0 {
+			d, ok = s.ArcDistToColl(x, y, vx, vy, k, 0)
+		} else {
+			d, ok = s.DistToColl(x, y, vx, vy, 0)
+			d *= v
+		}
+		if ok && d > tol && d < closest {
+			closest, ci = d, si
+		}
+	}
+	return closest, ci
+}
+
+// fallOff lets the ball which just rolled over the edge of level l fall to
+// the level below, possibly several times if it flies over the edge of that
+// level as well, against the obstacles of all on the level it falls to. The
+// new level, state and the time it took are returned.
+func (inp Input) fallOff(r *rand.Rand, all []Obstacle, l int, x, y, vx, vy float64) (int, float64, float64, float64, float64, float64) {
+	t, h := 0.0, inp.height(l)
+	// the ball is exactly on the edge, look just beyond it
+	v := math.Sqrt(vx*vx + vy*vy)
+	below := inp.levelAt(x+vx/v*edgeStep, y+vy/v*edgeStep, h)
+	for li := 0; li <= len(inp.Levels); li++ {
+		if inp.height(below) == h {
+			// rolled onto an adjacent level, or landed
+			return below, x, y, vx, vy, t
+		}
+		inp.Obstacles = inp.onLevel(all, below)
+		var dt float64
+		x, y, vx, vy, dt = inp.fall(r, h-inp.height(below), x, y, vx, vy)
+		t += dt
+		// it may land on a level it passed over, which is approximated by
+		// landing at the same position, or fly beyond the level below
+		landed := inp.levelAt(x, y, math.Nextafter(h, math.Inf(-1)))
+		if inp.height(landed) >= inp.height(below) {
+			return landed, x, y, vx, vy, t
+		}
+		h, below = inp.height(below), landed
+	}
+	inp.Error(errors.New("ball fell through all levels - did you have a bad config?"))
+	return 0, x, y, vx, vy, t
+}
+
+// level returns the index of the level with the given name.
+func (i *Input) level(name string) int {
+	if name == floor {
+		return 0
+	}
+	for li, l := range i.Levels {
+		if l.Name == name {
+			return li + 1
+		}
+	}
+	i.Error(errors.New(""), "unknown level '"+name+"', levels must be defined before use")
+	return 0
+}
+
+// levelMask parses 'on level ...' into a bit mask of the levels, 0 meaning
+// that the obstacle exists on all levels.
+func (i *Input) levelMask(d []string) uint64 {
+	if len(d) == 0 {
+		return 0
+	}
+	if len(d) < 2 {
+		i.Error(errors.New(""), "on expects at least 1 level")
+	}
+	var m uint64
+	for _, name := range d[1:] {
+		m |= 1 << uint(i.level(name))
+	}
+	return m
+}
+
+type parseLevel struct{}
+
+// Handle takes care of 'level name height x0 y0 x1 y1 ...', given either as
+// two corners of a rectangle or as a polygon.
+func (p parseLevel) Handle(d []string, i *Input) bool {
+	if d[0] != "level" {
+		return false
+	}
+	if len(d) < 3 {
+		i.Error(errors.New(""), "level expects a name, a height and 2 or more points")
+	}
+	if d[1] == floor || len(i.Levels) >= 63 {
+		i.Error(errors.New(""), "invalid or too many levels")
+	}
+	l := Level{Name: d[1], Height: i.num(d[2]), Outline: i.polygon("level", d[3:])}
+	if l.Height <= 0 {
+		i.Error(errors.New(""), "level must be above the floor")
+	}
+	i.Levels = append(i.Levels, l)
+	return true
+}
+
+// polygon parses the points x0 y0 x1 y1 ..., two points being the corners of
+// a rectangle.
+func (i *Input) polygon(name string, d []string) []float64 {
+	if len(d) < 4 || len(d)%2 != 0 {
+		i.Error(errors.New(""), name+" expects 2 or more points")
+	}
+	ps := []float64{}
+	for _, s := range d {
+		ps = append(ps, i.num(s))
+	}
+	if len(ps) == 4 {
+		x0, y0, x1, y1 := ps[0], ps[1], ps[2], ps[3]
+		ps = []float64{x0, y0, x1, y0, x1, y1, x0, y1}
+	}
+	if len(ps) < 6 {
+		i.Error(errors.New(""), name+" must have at least 3 corners")
+	}
+	return ps
+}
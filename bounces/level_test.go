@@ -0,0 +1,75 @@
+package bounces
+
+import (
+	"testing"
+)
+
+// tableScene has a table with a rail on its left edge, which only exists on
+// the table, in a room.
+const tableScene = `ball 0.02
+velocity uniform 1 1
+friction -0.5
+terminal 0.01
+elasticity 0.5
+
+level table 0.75 1 1 3 3
+line 1 1 1 3 on table
+start 2 2 table
+
+line 0 0 20 0
+line 20 0 20 4
+line 20 4 0 4
+line 0 4 0 0
+
+measure table 0 0 20 4 table
+`
+
+func TestLevels(t *testing.T) {
+	inp := parseScene(t, tableScene)
+	level(t, "slow on the table", inp, 0.5, 2.2, 2.3, 1)
+	level(t, "rolling off the table", inp, 3, 3, 20, 0)
+	// bouncing on the rail, and then rolling off the other edge
+	level(t, "bouncing on the rail", inp, -3, 3, 20, 0)
+
+	// the rail is not there on the floor
+	inp.Start, inp.StartLevel = [2]float64{0.5, 2}, 0
+	level(t, "under the table", inp, 1.5, 2.7, 2.8, 0)
+}
+
+// stepScene has a narrow step beside a table, the ball flying over it
+// falls in two stages towards a wall on the floor.
+const stepScene = `ball 0.02
+velocity uniform 1 1
+friction -0.5
+terminal 0.01
+elasticity 0.5
+
+level table 0.75 1 1 3 3
+level step 0.4 3 1 3.1 3
+line 1 1 1 3 on table
+line 4.2 0 4.2 4 on floor
+start 2 2 table
+
+line 0 0 20 0
+line 20 0 20 4
+line 20 4 0 4
+line 0 4 0 0
+
+measure table 0 0 20 4 table
+`
+
+func TestFallTwice(t *testing.T) {
+	inp := parseScene(t, stepScene)
+	// back under the table, the rail being only on it
+	level(t, "over the step into the wall", inp, 3, 0, 4.2, 0)
+}
+
+// level throws the ball along x with the speed v, which must stop between
+// lo and hi on the level l.
+func level(t *testing.T, name string, inp Input, v, lo, hi float64, l int) {
+	x, _, el := throw(inp, v, 0)
+	t.Log(name, "expected:", lo, hi, l, "got: ", x, el)
+	if el != l || x < lo || x > hi {
+		t.Error()
+	}
+}
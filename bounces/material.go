@@ -0,0 +1,93 @@
+package bounces
+
+import (
+	"errors"
+
+	"github.com/vron/bounces/material"
+)
+
+// surface is an obstacle from the line or shape package.
+type surface interface {
+	shaped
+	ArcDistToColl(x, y, vx, vy, k, r float64) (float64, bool)
+	BounceWith(x, y, vx, vy, r float64, e material.Restitution) (float64, float64)
+}
+
+// coated is an obstacle made of a material with a speed dependent
+// restitution, which replaces the elasticity of the object.
+type coated struct {
+	surface
+	restitution material.Restitution
+}
+
+func (o coated) Bounce(x, y, vx, vy, r, el float64) (float64, float64) {
+	return o.BounceWith(x, y, vx, vy, r, o.restitution)
+}
+
+// coat makes the obstacles added since from of the material as given by
+// 'material name'.
+func (i *Input) coat(d []string, from int) {
+	if len(d) == 0 {
+		return
+	}
+	if len(d) != 2 {
+		i.Error(errors.New(""), "material expects 1 argument")
+	}
+	e, ok := i.Materials[d[1]]
+	if !ok {
+		i.Error(errors.New(""), "unknown material '"+d[1]+"', materials must be defined before use")
+	}
+	for oi, o := range i.Obstacles[from:] {
+		s, ok := o.(surface)
+		if !ok {
+			i.Error(errors.New(""), "obstacle can not have a material")
+		}
+		i.Obstacles[from+oi] = coated{s, e}
+	}
+}
+
+type parseMaterial struct{}
+
+// Handle takes care of 'material name constant e', 'material name power e v p'
+// and 'material name table v1 e1 v2 e2 ...', see the material package.
+func (p parseMaterial) Handle(d []string, i *Input) bool {
+	if d[0] != "material" {
+		return false
+	}
+	if len(d) < 4 {
+		i.Error(errors.New(""), "material expects a name, a law and its parameters")
+	}
+	var e material.Restitution
+	args := d[3:]
+	switch d[2] {
+	case "constant":
+		if len(args) != 1 {
+			i.Error(errors.New(""), "constant expects 1 argument")
+		}
+		e = material.Constant(i.num(args[0]))
+	case "power":
+		if len(args) != 3 {
+			i.Error(errors.New(""), "power expects 3 arguments")
+		}
+		e = material.PowerLaw{E: i.num(args[0]), V: i.num(args[1]), P: i.num(args[2])}
+	case "table":
+		if len(args)%2 != 0 {
+			i.Error(errors.New(""), "table expects pairs of speed and restitution")
+		}
+		t := material.Table{}
+		for k := 0; k < len(args); k += 2 {
+			t.V, t.E = append(t.V, i.num(args[k])), append(t.E, i.num(args[k+1]))
+			if k > 0 && t.V[k/2] <= t.V[k/2-1] {
+				i.Error(errors.New(""), "table speeds must be increasing")
+			}
+		}
+		e = t
+	default:
+		i.Error(errors.New(""), "did not recognize the restitution '"+d[2]+"'")
+	}
+	if i.Materials == nil {
+		i.Materials = map[string]material.Restitution{}
+	}
+	i.Materials[d[1]] = e
+	return true
+}
@@ -0,0 +1,149 @@
+package bounces
+
+import (
+	"fmt"
+	"math"
+)
+
+// outcome is the final state of a single simulated trajectory, one
+// position and object type per ball.
+type outcome struct {
+	x, y  []float64
+	kind  []int
+	level []int
+}
+
+func (inp Input) newOutcome() outcome {
+	n := inp.ballCount()
+	return outcome{x: make([]float64, n), y: make([]float64, n), kind: make([]int, n), level: make([]int, n)}
+}
+
+// measure is a single reported probability, derived from the Rects in the
+// input. For each trajectory count returns how many of the relevant cases
+// hit the measure and how many cases there were.
+type measure struct {
+	Name   string
+	count  func(o *outcome) (hit, of int)
+	Target Target
+}
+
+// A Target is the precision wanted for a measure, as the half width of its
+// interval. A measure with neither Precision nor Relative set uses the one
+// given to Run, if both are set reaching either suffices. ReportOnly
+// measures do not affect when Run stops.
+type Target struct {
+	Precision  float64
+	Relative   float64
+	ReportOnly bool
+}
+
+// width returns the half width of the interval wanted for the estimate m,
+// with prec the precision of measures without a target of their own.
+func (t Target) width(m, prec float64) float64 {
+	if t.Precision == 0 && t.Relative == 0 {
+		return prec
+	}
+	return math.Max(t.Precision, t.Relative*math.Abs(m))
+}
+
+// region is an area a ball can end in, either a Rect or a room.
+type region struct {
+	name   string
+	in     func(o *outcome, bi int) bool
+	target Target
+}
+
+func (inp Input) regions() []region {
+	rs := []region{}
+	for _, rect := range inp.Measures {
+		rs = append(rs, region{rect.Name, inp.inMeasure(rect), rect.Target})
+	}
+	for ri, room := range inp.Rooms {
+		ri := ri
+		rs = append(rs, region{"room/" + room.Name, func(o *outcome, bi int) bool {
+			return inp.roomAt(o.x[bi], o.y[bi]) == ri
+		}, Target{}})
+	}
+	return rs
+}
+
+func (inp Input) measures() []measure {
+	n := inp.ballCount()
+	ms := []measure{}
+	for _, reg := range inp.regions() {
+		in := reg.in
+		if n == 1 {
+			ms = append(ms, measure{reg.name, func(o *outcome) (int, int) {
+				return b2i(in(o, 0)), 1
+			}, reg.target})
+			continue
+		}
+		for bi := 0; bi < n; bi++ {
+			bi := bi
+			ms = append(ms, measure{fmt.Sprintf("%v[%d]", reg.name, bi), func(o *outcome) (int, int) {
+				return b2i(in(o, bi)), 1
+			}, reg.target})
+		}
+		ms = append(ms, measure{reg.name + "/any", func(o *outcome) (int, int) {
+			for bi := range o.x {
+				if in(o, bi) {
+					return 1, 1
+				}
+			}
+			return 0, 1
+		}, reg.target})
+		ms = append(ms, measure{reg.name + "/all", func(o *outcome) (int, int) {
+			for bi := range o.x {
+				if !in(o, bi) {
+					return 0, 1
+				}
+			}
+			return 1, 1
+		}, reg.target})
+	}
+
+	// with several object types also report the probability per type, i.e.
+	// the fraction of the balls of that type ending in the measure.
+	if len(inp.Objects) < 2 {
+		return ms
+	}
+	for _, reg := range inp.regions() {
+		in := reg.in
+		for oi, obj := range inp.Objects {
+			oi := oi
+			ms = append(ms, measure{reg.name + "|" + obj.Name, func(o *outcome) (hit, of int) {
+				for bi := range o.x {
+					if o.kind[bi] != oi {
+						continue
+					}
+					hit += b2i(in(o, bi))
+					of++
+				}
+				return
+			}, reg.target})
+		}
+	}
+	return ms
+}
+
+// inMeasure returns if a ball of an outcome is inside rect, and on its level
+// if given.
+func (inp Input) inMeasure(rect Rect) func(o *outcome, bi int) bool {
+	return func(o *outcome, bi int) bool {
+		if rect.Level != "" && inp.levelName(o.level[bi]) != rect.Level {
+			return false
+		}
+		return rect.contains(o.x[bi], o.y[bi])
+	}
+}
+
+func (r Rect) contains(x, y float64) bool {
+	return x >= r.X && x <= r.X+r.W && y >= r.Y && y <= r.Y+r.H
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
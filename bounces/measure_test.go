@@ -0,0 +1,29 @@
+package bounces
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestTarget(t *testing.T) {
+	target(t, "measure a 0 0 1 1", Target{}, 0.01, 0.01)
+	target(t, "measure a 0 0 1 1 precision 0.1%", Target{Precision: 0.001}, 0.001, 0.001)
+	target(t, "measure a 0 0 1 1 floor rel 5%", Target{Relative: 0.05}, 0.2, 0.01)
+	target(t, "measure a 0 0 1 1 precision 0.02 rel 0.1", Target{Precision: 0.02, Relative: 0.1}, 0.5, 0.05)
+	target(t, "measure a 0 0 1 1 report", Target{ReportOnly: true}, 0.01, 0.01)
+}
+
+func target(t *testing.T, line string, e Target, m, w float64) {
+	inp := ParseInput(strings.NewReader("velocity lognormal 0.5 0.75 4\n"+line), func(e error, a ...interface{}) {
+		if e != nil {
+			t.Fatal(append(a, e)...)
+		}
+	})
+	a := inp.Measures[0].Target
+
+	t.Log("expected:", e, w, "got: ", a, a.width(m, 0.01))
+	if a != e || math.Abs(a.width(m, 0.01)-w) > 1e-12 {
+		t.Error()
+	}
+}
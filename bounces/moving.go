@@ -0,0 +1,248 @@
+package bounces
+
+import (
+	"errors"
+	"math"
+
+	"github.com/vron/bounces/line"
+	"github.com/vron/bounces/shape"
+)
+
+// A MovingObstacle is an obstacle whose position depends on the simulation
+// time t. MaxSpeed bounds the speed of any point on its surface.
+type MovingObstacle interface {
+	Bounds() (x, y, w, h float64)
+	MaxSpeed() float64
+	ClosestAt(t, x, y float64) (float64, float64)
+	VelocityAt(t, x, y float64) (float64, float64)
+	BounceAt(t, x, y, vx, vy, r, el float64) (float64, float64)
+}
+
+// A Motion moves an obstacle with the velocity (VX, VY) while rotating it
+// around the pivot (X, Y), which follows the motion, with the angular
+// velocity Omega. It only moves during the time interval [From, To].
+type Motion struct {
+	VX, VY      float64
+	X, Y, Omega float64
+	From, To    float64
+}
+
+func (m Motion) at(t float64) (dx, dy, theta float64) {
+	e := math.Max(m.From, math.Min(m.To, t)) - m.From
+	return m.VX * e, m.VY * e, m.Omega * e
+}
+
+func (m Motion) velocity(t, x, y float64) (float64, float64) {
+	if t < m.From || t > m.To {
+		return 0, 0
+	}
+	dx, dy, _ := m.at(t)
+	return m.VX - m.Omega*(y-m.Y-dy), m.VY + m.Omega*(x-m.X-dx)
+}
+
+// shaped is an obstacle that can be moved, as implemented by the line and
+// shape packages.
+type shaped interface {
+	Obstacle
+	Closest(x, y float64) (float64, float64)
+}
+
+func move(o Obstacle, dx, dy, theta, cx, cy float64) shaped {
+	switch o := o.(type) {
+	case line.Segment:
+		return o.Moved(dx, dy, theta, cx, cy)
+	case shape.Circle:
+		return o.Moved(dx, dy, theta, cx, cy)
+	case coated:
+		return coated{move(o.surface, dx, dy, theta, cx, cy).(surface), o.restitution}
+	}
+	return nil
+}
+
+// moving is an obstacle following a motion.
+type moving struct {
+	shape  shaped
+	motion Motion
+	reach  float64
+}
+
+// NewMovingObstacle makes the obstacle, which must come from the line or
+// shape package, move according to m.
+func NewMovingObstacle(o Obstacle, m Motion) (MovingObstacle, error) {
+	s := move(o, 0, 0, 0, 0, 0)
+	if s == nil {
+		return nil, errors.New("obstacle can not be moved")
+	}
+	reach := 0.0
+	switch o := o.(type) {
+	case line.Segment:
+		reach = math.Max(math.Hypot(o[0]-m.X, o[1]-m.Y), math.Hypot(o[0]+o[2]-m.X, o[1]+o[3]-m.Y))
+	case shape.Circle:
+		reach = math.Hypot(o.X-m.X, o.Y-m.Y) + o.R
+	}
+	return moving{s, m, reach}, nil
+}
+
+func (o moving) at(t float64) shaped {
+	dx, dy, theta := o.motion.at(t)
+	return move(o.shape, dx, dy, theta, o.motion.X, o.motion.Y)
+}
+
+// maxSweep is the largest rotation between two poses whose bounds are
+// joined to bound the area swept by a moving obstacle.
+const maxSweep = 0.1
+
+// Bounds returns the bounds of the area swept by the obstacle, or of its
+// start if it moves away forever.
+func (o moving) Bounds() (x, y, w, h float64) {
+	m := o.motion
+	span := m.To - m.From
+	if m.VX == 0 && m.VY == 0 {
+		// a full turn sweeps all of it
+		span = math.Min(span, 2*math.Pi/math.Abs(m.Omega))
+	}
+	if math.IsInf(span, 1) {
+		return o.at(m.From).Bounds()
+	}
+	n := math.Max(1, math.Ceil(math.Abs(m.Omega)*span/maxSweep))
+	xm, ym := math.MaxFloat64, math.MaxFloat64
+	xM, yM := -math.MaxFloat64, -math.MaxFloat64
+	for k := 0.0; k <= n; k++ {
+		x, y, w, h := o.at(m.From + span*k/n).Bounds()
+		xm, ym = math.Min(xm, x), math.Min(ym, y)
+		xM, yM = math.Max(xM, x+w), math.Max(yM, y+h)
+	}
+	// the rotation between two poses bulges out beyond their bounds
+	e := o.reach * (1 - math.Cos(m.Omega*span/n/2))
+	return xm - e, ym - e, xM - xm + 2*e, yM - ym + 2*e
+}
+
+func (o moving) MaxSpeed() float64 {
+	return math.Hypot(o.motion.VX, o.motion.VY) + math.Abs(o.motion.Omega)*o.reach
+}
+
+func (o moving) ClosestAt(t, x, y float64) (float64, float64) {
+	return o.at(t).Closest(x, y)
+}
+
+func (o moving) VelocityAt(t, x, y float64) (float64, float64) {
+	return o.motion.velocity(t, x, y)
+}
+
+// BounceAt bounces in the frame of reference of the moving surface, such that
+// a moving obstacle transfers its momentum to the ball. The normal is taken
+// from the closest point as the ball may hit the end of a segment.
+func (o moving) BounceAt(t, x, y, vx, vy, r, el float64) (float64, float64) {
+	cx, cy := o.ClosestAt(t, x, y)
+	sx, sy := o.VelocityAt(t, cx, cy)
+	nx, ny := x-cx, y-cy
+	l := math.Sqrt(nx*nx + ny*ny)
+	vx, vy = reflect(vx-sx, vy-sy, nx/l, ny/l, el)
+	return vx + sx, vy + sy
+}
+
+// reflect bounces the velocity against a surface with the normal (nx, ny),
+// loosing the fraction 1-el of the energy in the normal direction. Grazing
+// contacts separate with at least contactSpeed, otherwise a surface pushing
+// the ball would result in an endless number of ever smaller bounces.
+func reflect(vx, vy, nx, ny, el float64) (float64, float64) {
+	n := vx*nx + vy*ny
+	if n >= contactSpeed {
+		return vx, vy
+	}
+	d := math.Max(-n*math.Sqrt(el), contactSpeed) - n
+	return vx + d*nx, vy + d*ny
+}
+
+// closestMover checks if the ball, starting at time t0, hits any of the
+// moving obstacles before it has travelled dist. It uses conservative
+// advancement since the obstacles may move into the path of the ball.
+func (inp Input) closestMover(t0, dist, x, y, vx, vy float64) (float64, MovingObstacle) {
+	v, f := math.Sqrt(vx*vx+vy*vy), inp.friction()
+	n0, n1 := vx/v, vy/v
+	T := travelTime(dist, v, f)
+	if f < 0 {
+		T = math.Min(T, (inp.Terminal-v)/f)
+	}
+
+	var hit MovingObstacle
+	for _, m := range inp.Movers {
+		vmax := v + math.Max(0, f)*T + m.MaxSpeed()
+		for t, i := 0.0, 0; t < T && i < 100*maxBounce; i++ {
+			s, vt := v*t+f*t*t/2, v+f*t
+			px, py := x+n0*s, y+n1*s
+			cx, cy := m.ClosestAt(t0+t, px, py)
+			dx, dy := px-cx, py-cy
+			d := math.Sqrt(dx*dx + dy*dy)
+			gap := d - inp.Ball
+			if gap < tol {
+				sx, sy := m.VelocityAt(t0+t, cx, cy)
+				if ((n0*vt-sx)*dx+(n1*vt-sy)*dy)/d < -tol {
+					T, hit = t, m
+					break
+				}
+				gap = tol
+			}
+			t += gap / vmax
+		}
+	}
+	if hit == nil {
+		return dist, nil
+	}
+	return v*T + f*T*T/2, hit
+}
+
+// travelTime returns the time needed to travel dist starting with the speed
+// v and accelerating with f.
+func travelTime(dist, v, f float64) float64 {
+	v1 := math.Sqrt(math.Max(0, v*v+2*f*dist))
+	return 2 * dist / (v + v1)
+}
+
+// motion makes the obstacles added since from move as parsed from d, as
+// split of by splitOptions.
+func (i *Input) motion(d []string, from int) {
+	if len(d) == 0 {
+		return
+	}
+	for _, j := range i.Jitters {
+		if j.To > from {
+			i.Error(errors.New(""), "an obstacle can not both move and jitter")
+		}
+	}
+	// the jitter of a group is only known at its end
+	if len(i.groups) > 0 {
+		i.Error(errors.New(""), "an obstacle can not both move and jitter")
+	}
+	for _, l := range i.Layers[from:] {
+		if l != 0 {
+			i.Error(errors.New(""), "moving obstacles are on all levels")
+		}
+	}
+	m := Motion{To: math.Inf(1)}
+	args := d[1:]
+	switch d[0] {
+	case "move":
+		if len(args) != 2 && len(args) != 4 {
+			i.Error(errors.New(""), "move expects 2 or 4 arguments")
+		}
+		m.VX, m.VY = i.num(args[0]), i.num(args[1])
+		args = args[2:]
+	case "swing":
+		if len(args) != 3 && len(args) != 5 {
+			i.Error(errors.New(""), "swing expects 3 or 5 arguments")
+		}
+		m.X, m.Y, m.Omega = i.num(args[0]), i.num(args[1]), i.num(args[2])
+		args = args[3:]
+	}
+	if len(args) == 2 {
+		m.From, m.To = i.num(args[0]), i.num(args[1])
+	}
+	for _, o := range i.Obstacles[from:] {
+		mo, err := NewMovingObstacle(o, m)
+		i.Error(err)
+		i.Movers = append(i.Movers, mo)
+	}
+	i.Obstacles = i.Obstacles[:from]
+	i.Layers = i.Layers[:from]
+}
@@ -0,0 +1,223 @@
+package bounces
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/vron/bounces/line"
+	"github.com/vron/bounces/shape"
+)
+
+func TestMovingBounds(t *testing.T) {
+	// a door swinging a quarter turn around its hinge
+	door, _ := NewMovingObstacle(line.SegmentFromPoints(4, 0, 4, 1), Motion{X: 4, Omega: math.Pi / 4, From: 0, To: 2})
+	movingBounds(t, door, 3, 0, 4, 1)
+	// a ball moving for 8 time units
+	ball, _ := NewMovingObstacle(shape.NewCircle(1, 1, 0.15), Motion{VX: 0.2, VY: 0.1, To: 8})
+	movingBounds(t, ball, 0.85, 0.85, 2.75, 1.95)
+	// turning forever sweeps a full circle
+	spin, _ := NewMovingObstacle(line.SegmentFromPoints(0, 0, 1, 0), Motion{Omega: 1, To: math.Inf(1)})
+	movingBounds(t, spin, -1, -1, 1, 1)
+}
+
+func movingBounds(t *testing.T, m MovingObstacle, x0, y0, x1, y1 float64) {
+	x, y, w, h := m.Bounds()
+	t.Log("expected:", x0, y0, x1, y1, "got: ", x, y, x+w, y+h)
+	if math.Abs(x-x0) > 1e-2 || math.Abs(y-y0) > 1e-2 || math.Abs(x+w-x1) > 1e-2 || math.Abs(y+h-y1) > 1e-2 {
+		t.Error()
+	}
+	// never smaller than the true sweep
+	if x > x0+tol || y > y0+tol || x+w < x1-tol || y+h < y1-tol {
+		t.Error()
+	}
+}
+
+func TestReflect(t *testing.T) {
+	for _, c := range []struct {
+		vx, vy, nx, ny, el float64
+		ex, ey             float64
+	}{
+		// head on, keeping a quarter of the energy
+		{1, 0, -1, 0, 0.25, -0.5, 0},
+		// separating already
+		{1, 1, 0, 1, 0.25, 1, 1},
+		// grazing, leaving with at least contactSpeed
+		{1, -1e-4, 0, 1, 0.25, 1, contactSpeed},
+	} {
+		vx, vy := reflect(c.vx, c.vy, c.nx, c.ny, c.el)
+		t.Log("expected:", c.ex, c.ey, "got: ", vx, vy)
+		if math.Abs(vx-c.ex) > tol || math.Abs(vy-c.ey) > tol {
+			t.Error()
+		}
+	}
+}
+
+func TestBounceAt(t *testing.T) {
+	// a wall moving onto a ball at rest throws it with (1+sqrt(el)) times
+	// its own speed
+	wall, _ := NewMovingObstacle(line.SegmentFromPoints(1, -1, 1, 1), Motion{VX: -1, To: math.Inf(1)})
+	for _, el := range []float64{1, 0.25} {
+		vx, vy := wall.BounceAt(0, 0.9, 0, 0, 0, 0.1, el)
+		exp := -(1 + math.Sqrt(el))
+		t.Log("expected:", exp, 0, "got: ", vx, vy)
+		if math.Abs(vx-exp) > tol || math.Abs(vy) > tol {
+			t.Error()
+		}
+	}
+	// at rest it is a plain wall
+	wall, _ = NewMovingObstacle(line.SegmentFromPoints(1, -1, 1, 1), Motion{VX: -1, From: 1, To: 2})
+	vx, vy := wall.BounceAt(0, 0.9, 0, 1, 0, 0.1, 0.25)
+	t.Log("expected:", -0.5, 0, "got: ", vx, vy)
+	if math.Abs(vx+0.5) > tol || math.Abs(vy) > tol {
+		t.Error()
+	}
+}
+
+func TestClosestAt(t *testing.T) {
+	door, _ := NewMovingObstacle(line.SegmentFromPoints(4, 0, 4, 1), Motion{X: 4, Omega: math.Pi / 4, From: 0, To: 2})
+	s := math.Sqrt(0.5)
+	closestAt(t, door, 0, 4, 2, 4, 1)
+	closestAt(t, door, 1, 4-2*s, 2*s, 4-s, s)
+	// it stops at To
+	closestAt(t, door, 3, 2, 0, 3, 0)
+
+	ball, _ := NewMovingObstacle(shape.NewCircle(1, 1, 0.15), Motion{VX: 0.2, VY: 0.1, From: 2, To: 8})
+	closestAt(t, ball, 1, 3, 1, 1.15, 1)
+	closestAt(t, ball, 6, 3, 1.4, 1.95, 1.4)
+	closestAt(t, ball, 20, 3, 1.6, 2.35, 1.6)
+}
+
+func closestAt(t *testing.T, m MovingObstacle, tm, x, y, ex, ey float64) {
+	cx, cy := m.ClosestAt(tm, x, y)
+	t.Log("expected:", ex, ey, "got: ", cx, cy)
+	if math.Abs(cx-ex) > 1e-9 || math.Abs(cy-ey) > 1e-9 {
+		t.Error()
+	}
+}
+
+func TestClosestMover(t *testing.T) {
+	inp := Input{}
+	inp.Ball = 0.1
+	wall, _ := NewMovingObstacle(line.SegmentFromPoints(2, -1, 2, 1), Motion{VX: -1, To: math.Inf(1)})
+	inp.Movers = []MovingObstacle{wall}
+
+	// both meet halfway, less the radius of the ball
+	d, m := inp.closestMover(0, 10, 0, 0, 1, 0)
+	t.Log("expected:", 0.95, wall, "got: ", d, m)
+	if math.Abs(d-0.95) > 1e-6 || m != wall {
+		t.Error()
+	}
+	// not before the ball stops
+	d, m = inp.closestMover(0, 0.5, 0, 0, 1, 0)
+	t.Log("expected:", 0.5, nil, "got: ", d, m)
+	if d != 0.5 || m != nil {
+		t.Error()
+	}
+	// nor if it runs away from the ball
+	inp.Movers[0], _ = NewMovingObstacle(line.SegmentFromPoints(2, -1, 2, 1), Motion{VX: 2, To: math.Inf(1)})
+	d, m = inp.closestMover(0, 10, 0, 0, 1, 0)
+	t.Log("expected:", 10, nil, "got: ", d, m)
+	if d != 10 || m != nil {
+		t.Error()
+	}
+}
+
+func TestMotionParse(t *testing.T) {
+	inp := parseScene(t, `velocity uniform 1 1
+line 4 0 4 1 swing 4 0 0.6 0 2
+circle 1 1 0.15 move 0.2 0.1
+line 0 0 1 0
+measure all 0 0 5 3
+`)
+	t.Log("expected:", 3, 4, "got: ", len(inp.Obstacles), len(inp.Movers))
+	if len(inp.Obstacles) != 3 || len(inp.Movers) != 4 {
+		t.FailNow()
+	}
+	// a line comes with a circle at either end
+	for i, exp := range map[int]Motion{
+		0: {X: 4, Omega: 0.6, From: 0, To: 2},
+		3: {VX: 0.2, VY: 0.1, To: math.Inf(1)},
+	} {
+		m := inp.Movers[i].(moving).motion
+		t.Log("expected:", exp, "got: ", m)
+		if m != exp {
+			t.Error()
+		}
+	}
+
+	for _, scene := range []string{
+		"line 0 0 1 0 move 1\n",
+		"line 0 0 1 0 swing 0 0 1 2\n",
+		"line 0 0 1 0 move 1 0 swing 0 0 1\n",
+		"group\nline 0 0 1 0 move 1 0\nend jitter 0.1 0\n",
+	} {
+		failed := parseFails("velocity uniform 1 1\n" + scene + "measure all 0 0 5 3\n")
+		t.Log("expected to fail:", scene, "got: ", failed)
+		if !failed {
+			t.Error()
+		}
+	}
+}
+
+// parseFails returns whether the scene fails to parse.
+func parseFails(scene string) (failed bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			failed = true
+		}
+	}()
+	ParseInput(strings.NewReader(scene), func(e error, a ...interface{}) {
+		if e != nil {
+			panic(e)
+		}
+	})
+	return false
+}
+
+// doorScene has a door swinging shut onto a slow ball behind it.
+const doorScene = `ball 0.05
+velocity uniform 1 1
+friction -0.01
+terminal 0.01
+elasticity 0.5
+start 1.6 0.5
+
+line 0 0 5 0
+line 5 0 5 3
+line 5 3 0 3
+line 0 3 0 0
+
+line 2 0 2 1 swing 2 0 1 0 1.2
+
+measure all 0 0 5 3
+`
+
+func TestDoorCloses(t *testing.T) {
+	inp := parseScene(t, doorScene)
+	var hits []Event
+	inp.trace = func(e Event) {
+		if e.Kind == "bounce" && strings.HasPrefix(e.Obstacle, "moving") {
+			hits = append(hits, e)
+		}
+	}
+	var viol []string
+	inp.check.report = func(kind string, bounce int, x, y float64, detail string) {
+		viol = append(viol, kind+": "+detail)
+	}
+	x, y, _ := throw(inp, 0.05, 0)
+
+	// left alone it would stop at 1.725 0.5, but is pushed away by the door
+	t.Log("expected pushed by the door, got: ", len(hits), "hits, stopped at", x, y)
+	if len(hits) == 0 || math.Hypot(x-1.725, y-0.5) < 0.1 {
+		t.Error()
+	}
+	// away from the door, not through it
+	if len(hits) > 0 && math.Hypot(hits[0].VX, hits[0].VY) < 0.1 {
+		t.Error()
+	}
+	t.Log("expected no violations, got: ", viol)
+	if len(viol) > 0 {
+		t.Error()
+	}
+}
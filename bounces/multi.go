@@ -0,0 +1,205 @@
+package bounces
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// ball is the state of one ball when simulating several at once. Contrary to
+// the single ball simulation all balls have to be advanced in time rather
+// than distance such that they can meet.
+type ball struct {
+	obj          Object
+	x, y, vx, vy float64
+	r, m         float64
+	moving       bool
+}
+
+func (inp Input) simulateMany(r *rand.Rand, o *outcome) bool {
+	bs := inp.placeBalls(r, o)
+	if inp.check.on() {
+		inp.check.start(inp)
+	}
+	for bi, b := range bs {
+		inp.event("start", bi, b.x, b.y, b.vx, b.vy, 0, nil)
+	}
+	for i := 0; i < maxBounce*len(bs); i++ {
+		// find the first event, i.e. a ball reaching an obstacle, a ball coming
+		// to rest or two balls touching each other.
+		dt, first, other, wall := math.MaxFloat64, -1, -1, Obstacle(nil)
+		for bi := range bs {
+			if !bs[bi].moving {
+				continue
+			}
+			if t, ob := inp.nextEvent(&bs[bi]); t < dt {
+				dt, first, wall = t, bi, ob
+			}
+		}
+		if first < 0 {
+			for bi := range bs {
+				o.x[bi], o.y[bi] = bs[bi].x, bs[bi].y
+			}
+			return true
+		}
+		for bi := range bs {
+			for bj := bi + 1; bj < len(bs); bj++ {
+				if !bs[bi].moving && !bs[bj].moving {
+					continue
+				}
+				if t, ok := contact(&bs[bi], &bs[bj], dt); ok && t < dt {
+					dt, first, other, wall = t, bi, bj, nil
+				}
+			}
+		}
+
+		for bi := range bs {
+			bs[bi].advance(dt)
+			if inp.check.on() {
+				inp.checkPosition(i, 0, bs[bi].x, bs[bi].y, bs[bi].r)
+			}
+		}
+		b := &bs[first]
+		switch {
+		case other >= 0:
+			e0 := b.energy() + bs[other].energy()
+			inp.collide(b, &bs[other])
+			inp.event("ball", first, b.x, b.y, b.vx, b.vy, 0, nil)
+			inp.event("ball", other, bs[other].x, bs[other].y, bs[other].vx, bs[other].vy, 0, nil)
+			if inp.check.on() && inp.BallElasticity <= 1 {
+				inp.checkEnergy(i, b.x, b.y, e0, b.energy()+bs[other].energy())
+			}
+		case wall != nil:
+			e0 := b.energy()
+			b.vx, b.vy = wall.Bounce(b.x, b.y, b.vx, b.vy, b.r, b.obj.Elasticity)
+			if _, c := wall.(coated); inp.check.on() && !c && b.obj.Elasticity <= 1 {
+				inp.checkEnergy(i, b.x, b.y, e0, b.energy())
+			}
+			b.settle()
+			inp.event("bounce", first, b.x, b.y, b.vx, b.vy, 0, wall)
+		default:
+			b.vx, b.vy, b.moving = 0, 0, false
+			inp.event("stop", first, b.x, b.y, 0, 0, 0, nil)
+		}
+	}
+
+	inp.Error(errors.New("maxBounce reached - did you have a bad config?"))
+	return false
+}
+
+// placeBalls draws the objects and puts the balls on a ring around the
+// start, with the ring just large enough that no two balls overlap.
+func (inp Input) placeBalls(r *rand.Rand, o *outcome) []ball {
+	bs := make([]ball, len(inp.Balls))
+	rmax := 0.0
+	for bi := range bs {
+		b := &bs[bi]
+		b.obj, o.kind[bi] = inp.drawObject(r)
+		if len(inp.Objects) == 0 && inp.Balls[bi] != 0 {
+			b.obj.Ball = inp.Balls[bi]
+		}
+		b.r, b.m = b.obj.Ball, b.obj.Ball*b.obj.Ball*b.obj.Ball
+		rmax = math.Max(rmax, b.r)
+	}
+
+	d := rmax * 1.001 / math.Sin(math.Pi/float64(len(bs)))
+	phase := r.Float64() * math.Pi * 2
+	for bi := range bs {
+		theta := phase + float64(bi)*math.Pi*2/float64(len(bs))
+		b := &bs[bi]
+		b.x, b.y = inp.Start[0]+d*math.Cos(theta), inp.Start[1]+d*math.Sin(theta)
+		b.vx, b.vy = b.obj.Velocity(r)
+		b.settle()
+	}
+	return bs
+}
+
+// nextEvent returns the time until the ball either reaches the next obstacle
+// or comes to rest, in which case the obstacle is nil.
+func (inp Input) nextEvent(b *ball) (float64, Obstacle) {
+	v, f := math.Sqrt(b.vx*b.vx+b.vy*b.vy), b.obj.friction()
+	stop := math.MaxFloat64
+	if f < 0 {
+		stop = (b.obj.Terminal - v) / f
+	}
+	dist, ob := inp.closesObstacle(b.x, b.y, b.vx, b.vy, b.r)
+	if ob == nil {
+		inp.Error(errors.New("did not collie with any obstacle"))
+	}
+	disc := v*v + 2*f*dist
+	if disc < 0 {
+		return stop, nil
+	}
+	if t := 2 * dist / (v + math.Sqrt(disc)); t < stop {
+		return t, ob
+	}
+	return stop, nil
+}
+
+// contact finds the first time within [0, T] at which the two balls touch
+// while approaching each other using conservative advancement.
+func contact(a, b *ball, T float64) (float64, bool) {
+	acc := math.Max(0, a.obj.friction()) + math.Max(0, b.obj.friction())
+	vmax := math.Sqrt(a.vx*a.vx+a.vy*a.vy) + math.Sqrt(b.vx*b.vx+b.vy*b.vy) + acc*T
+	if vmax <= 0 {
+		return 0, false
+	}
+	for t, i := 0.0, 0; t <= T && i < maxBounce; i++ {
+		ax, ay, avx, avy := a.at(t)
+		bx, by, bvx, bvy := b.at(t)
+		dx, dy := bx-ax, by-ay
+		d := math.Sqrt(dx*dx + dy*dy)
+		gap := d - a.r - b.r
+		if gap < tol {
+			if ((bvx-avx)*dx+(bvy-avy)*dy)/d < -tol {
+				return t, true
+			}
+			gap = tol
+		}
+		t += gap / vmax
+	}
+	return 0, false
+}
+
+func (b *ball) at(t float64) (x, y, vx, vy float64) {
+	if !b.moving {
+		return b.x, b.y, 0, 0
+	}
+	v, f := math.Sqrt(b.vx*b.vx+b.vy*b.vy), b.obj.friction()
+	n0, n1 := b.vx/v, b.vy/v
+	s := v*t + f*t*t/2
+	v += f * t
+	return b.x + n0*s, b.y + n1*s, n0 * v, n1 * v
+}
+
+func (b *ball) advance(t float64) {
+	b.x, b.y, b.vx, b.vy = b.at(t)
+}
+
+// collide resolves the impact between two touching balls, the normal
+// component of the relative velocity loosing energy as for the walls.
+func (inp Input) collide(a, b *ball) {
+	nx, ny := b.x-a.x, b.y-a.y
+	l := math.Sqrt(nx*nx + ny*ny)
+	nx, ny = nx/l, ny/l
+	u := (a.vx-b.vx)*nx + (a.vy-b.vy)*ny
+	if u <= 0 {
+		return
+	}
+	j := (1 + math.Sqrt(inp.BallElasticity)) * u / (1/a.m + 1/b.m)
+	a.vx, a.vy = a.vx-j/a.m*nx, a.vy-j/a.m*ny
+	b.vx, b.vy = b.vx+j/b.m*nx, b.vy+j/b.m*ny
+	a.settle()
+	b.settle()
+}
+
+func (b *ball) energy() float64 {
+	return b.m * (b.vx*b.vx + b.vy*b.vy)
+}
+
+func (b *ball) settle() {
+	b.moving = !b.obj.stopped(b.vx, b.vy)
+	if !b.moving {
+		b.vx, b.vy = 0, 0
+	}
+}
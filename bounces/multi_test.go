@@ -0,0 +1,112 @@
+package bounces
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// newBall returns a moving ball of radius r at (x, y).
+func newBall(x, y, vx, vy, r float64) ball {
+	b := ball{obj: Object{Ball: r, Terminal: 1e-6}, x: x, y: y, vx: vx, vy: vy, r: r, m: r * r * r}
+	b.settle()
+	return b
+}
+
+func TestCollideHeadOn(t *testing.T) {
+	inp := Input{BallElasticity: 1}
+	a, b := newBall(0, 0, 1, 0, 0.1), newBall(0.2, 0, -0.5, 0, 0.1)
+	inp.collide(&a, &b)
+
+	t.Log("expected:", -0.5, 0, 1, 0, "got: ", a.vx, a.vy, b.vx, b.vy)
+	if math.Abs(a.vx+0.5) > 1e-12 || math.Abs(b.vx-1) > 1e-12 || a.vy != 0 || b.vy != 0 {
+		t.Error()
+	}
+
+	// a ball at rest takes all of the velocity
+	a, b = newBall(0, 0, 1, 0, 0.1), newBall(0.2, 0, 0, 0, 0.1)
+	inp.collide(&a, &b)
+	t.Log("expected:", 0, 1, "got: ", a.vx, b.vx)
+	if math.Abs(a.vx) > 1e-12 || math.Abs(b.vx-1) > 1e-12 || a.moving || !b.moving {
+		t.Error()
+	}
+}
+
+// TestCollideMomentum collides random touching balls, which must conserve
+// momentum, not gain energy and leave separating.
+func TestCollideMomentum(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for k := 0; k < 1000; k++ {
+		inp := Input{BallElasticity: r.Float64()}
+		ra, rb := 0.01+r.Float64(), 0.01+r.Float64()
+		th := 2 * math.Pi * r.Float64()
+		a := newBall(0, 0, r.NormFloat64(), r.NormFloat64(), ra)
+		b := newBall((ra+rb)*math.Cos(th), (ra+rb)*math.Sin(th), r.NormFloat64(), r.NormFloat64(), rb)
+		px, py := a.m*a.vx+b.m*b.vx, a.m*a.vy+b.m*b.vy
+		e0 := a.energy() + b.energy()
+		inp.collide(&a, &b)
+
+		qx, qy := a.m*a.vx+b.m*b.vx, a.m*a.vy+b.m*b.vy
+		sep := (b.vx-a.vx)*math.Cos(th) + (b.vy-a.vy)*math.Sin(th)
+		if math.Abs(px-qx) > 1e-9 || math.Abs(py-qy) > 1e-9 || a.energy()+b.energy() > e0*(1+1e-9) || sep < -1e-9 {
+			t.Log("expected:", px, py, e0, "got: ", qx, qy, a.energy()+b.energy(), "separating at", sep)
+			t.Error()
+		}
+	}
+}
+
+// TestContact moves random approaching balls to their contact, where they
+// must touch without having overlapped before.
+func TestContact(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	hits := 0
+	for k := 0; k < 1000; k++ {
+		ra, rb := 0.01+0.1*r.Float64(), 0.01+0.1*r.Float64()
+		a := newBall(0, 0, 1+r.Float64(), 0.1*r.NormFloat64(), ra)
+		b := newBall(1, 0.1*r.NormFloat64(), -r.Float64(), 0.1*r.NormFloat64(), rb)
+		a.obj.Friction, b.obj.Friction = -0.1*r.Float64(), -0.1*r.Float64()
+		tc, ok := contact(&a, &b, 2)
+		if !ok {
+			continue
+		}
+		hits++
+		for s := 0.0; s < tc; s += tc / 100 {
+			ax, ay, _, _ := a.at(s)
+			bx, by, _, _ := b.at(s)
+			if d := math.Hypot(bx-ax, by-ay); d < ra+rb-maxPenetration {
+				t.Log("expected no overlap before", tc, "got: ", d-ra-rb, "at", s)
+				t.Error()
+			}
+		}
+		a.advance(tc)
+		b.advance(tc)
+		if d := math.Hypot(b.x-a.x, b.y-a.y); math.Abs(d-ra-rb) > maxPenetration {
+			t.Log("expected touching, got: ", d-ra-rb)
+			t.Error()
+		}
+	}
+	if hits < 500 {
+		t.Log("expected most balls to meet, got: ", hits)
+		t.Error()
+	}
+}
+
+// TestNoOverlap checks that the balls of a run of several balls do not
+// overlap where they stop.
+func TestNoOverlap(t *testing.T) {
+	inp := readScene(t, "../geo/05_marbles.txt")
+	r := rand.New(rand.NewSource(1))
+	o := inp.newOutcome()
+	for k := 0; k < 500; k++ {
+		inp.trajectory(r, &o)
+		for i := range inp.Balls {
+			for j := i + 1; j < len(inp.Balls); j++ {
+				d := math.Hypot(o.x[i]-o.x[j], o.y[i]-o.y[j])
+				if p := inp.Balls[i] + inp.Balls[j] - d; p > maxPenetration {
+					t.Log("expected no overlap, got: ", p, "between", i, j, "of trajectory", k)
+					t.Error()
+				}
+			}
+		}
+	}
+}
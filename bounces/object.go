@@ -0,0 +1,174 @@
+package bounces
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// A Sampler draws one value of an uncertain parameter.
+type Sampler func(r *rand.Rand) float64
+
+// An Object describes the physical properties of one type of thrown object.
+// When an Input lists several objects one is drawn per trajectory (and per
+// ball) according to the weights.
+type Object struct {
+	Name   string
+	Weight float64
+
+	Ball     float64
+	BallDist Sampler
+	// Inertia is the rolling inertia factor I/(m*r*r), e.g. 2/5 for a solid
+	// sphere, reducing the effect of the friction accordingly.
+	Inertia  float64
+	Velocity VelocitySampler
+	Friction float64
+	Terminal float64
+	// Elasticity is the fraction of the energy of the normal speed kept in a
+	// bounce, i.e. the square of a coefficient of restitution.
+	Elasticity float64
+	// Curl makes the object, e.g. a coin rolling on its edge, follow a curved
+	// path with the curvature Curl/v, the direction being random.
+	Curl float64
+
+	// uncertain parameters, if set they are drawn for every trajectory
+	InertiaDist    Sampler
+	FrictionDist   Sampler
+	TerminalDist   Sampler
+	ElasticityDist Sampler
+	CurlDist       Sampler
+}
+
+// maxRedraws is the number of times a sample outside of the range of its
+// parameter is drawn again before it is clamped to the range.
+const maxRedraws = 100
+
+// maxFriction is the weakest sampled friction, such that the ball stops.
+const maxFriction = -1e-3
+
+// sample returns a copy of the object with all uncertain parameters drawn,
+// the distributions being truncated to the valid range of each parameter.
+func (o Object) sample(r *rand.Rand) Object {
+	draw := func(v *float64, s Sampler, min, max float64) {
+		if s == nil {
+			return
+		}
+		for i := 0; i < maxRedraws; i++ {
+			if *v = s(r); *v >= min && *v <= max {
+				return
+			}
+		}
+		*v = math.Min(math.Max(*v, min), max)
+	}
+	draw(&o.Ball, o.BallDist, 0, math.Inf(1))
+	draw(&o.Inertia, o.InertiaDist, 0, math.Inf(1))
+	draw(&o.Friction, o.FrictionDist, math.Inf(-1), maxFriction)
+	draw(&o.Terminal, o.TerminalDist, 0, math.Inf(1))
+	draw(&o.Elasticity, o.ElasticityDist, 0, math.Inf(1))
+	draw(&o.Curl, o.CurlDist, 0, math.Inf(1))
+	return o
+}
+
+func (o Object) friction() float64 {
+	return o.Friction / (1 + o.Inertia)
+}
+
+func (o Object) stopped(vx, vy float64) bool {
+	return math.Sqrt(vx*vx+vy*vy) < o.Terminal
+}
+
+// drawObject selects the object to throw, returning it and its index in
+// Objects.
+func (inp Input) drawObject(r *rand.Rand) (Object, int) {
+	if len(inp.Objects) == 0 {
+		return inp.Object.sample(r), 0
+	}
+	if len(inp.Objects) == 1 {
+		return inp.Objects[0].sample(r), 0
+	}
+	total := 0.0
+	for _, o := range inp.Objects {
+		total += o.Weight
+	}
+	u := r.Float64() * total
+	for oi, o := range inp.Objects {
+		if u < o.Weight || oi == len(inp.Objects)-1 {
+			return o.sample(r), oi
+		}
+		u -= o.Weight
+	}
+	panic("unreachable")
+}
+
+// object returns the object currently being defined by the input.
+func (i *Input) object() *Object {
+	if len(i.Objects) == 0 {
+		return &i.Object
+	}
+	return &i.Objects[len(i.Objects)-1]
+}
+
+// param parses a parameter given either as a number or as a distribution.
+func (i *Input) param(d []string, v *float64, s *Sampler) {
+	switch len(d) {
+	case 2:
+		*v, *s = i.num(d[1]), nil
+	case 4:
+		*s = i.sampler(d[1:])
+	default:
+		i.Error(errors.New(""), d[0]+" expects 1 argument or a distribution")
+	}
+}
+
+// sampler parses a distribution as given by e.g. 'uniform 0.1 0.2'.
+func (i *Input) sampler(d []string) Sampler {
+	if len(d) != 3 {
+		i.Error(errors.New(""), "distributions expects 2 arguments")
+	}
+	a, b := i.num(d[1]), i.num(d[2])
+	switch d[0] {
+	case "uniform":
+		return func(r *rand.Rand) float64 {
+			return r.Float64()*(b-a) + a
+		}
+	case "normal":
+		return func(r *rand.Rand) float64 {
+			return r.NormFloat64()*b + a
+		}
+	case "lognormal":
+		return func(r *rand.Rand) float64 {
+			return math.Exp(r.NormFloat64()*b + a)
+		}
+	}
+	i.Error(errors.New(""), "did not recognize the distr. '"+d[0]+"'")
+	return nil
+}
+
+type parseObject struct{}
+
+func (p parseObject) Handle(d []string, i *Input) bool {
+	if d[0] != "object" {
+		return false
+	}
+	if len(d) != 3 {
+		i.Error(errors.New(""), "object expects 2 arguments")
+	}
+	o := i.Object
+	o.Name, o.Weight = d[1], i.num(d[2])
+	if o.Weight <= 0 {
+		i.Error(errors.New(""), "object weight must be positive")
+	}
+	i.Objects = append(i.Objects, o)
+	return true
+}
+
+type parseInertia struct{}
+
+func (p parseInertia) Handle(d []string, i *Input) bool {
+	if d[0] != "inertia" {
+		return false
+	}
+	o := i.object()
+	i.param(d, &o.Inertia, &o.InertiaDist)
+	return true
+}
@@ -0,0 +1,69 @@
+package bounces
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestSampleFriction samples a friction distribution crossing zero, which
+// must only give frictions stopping the ball, and runs it.
+func TestSampleFriction(t *testing.T) {
+	scene := `ball 0.05
+velocity lognormal 0.5 0.75 4
+start 1 1
+terminal 0.01
+friction normal -0.1 0.1
+line 0 0 2 0
+line 2 0 2 2
+line 2 2 0 2
+line 0 2 0 0
+measure a 0 0 1 1
+`
+	// errors are only counted as they are reported by the workers
+	errs := int32(0)
+	inp := ParseInput(strings.NewReader(scene), func(e error, a ...interface{}) {
+		if e != nil {
+			atomic.AddInt32(&errs, 1)
+		}
+	})
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		if f := inp.Object.sample(r).Friction; f > maxFriction {
+			t.Log("expected a friction below", maxFriction, "got: ", f)
+			t.Fatal()
+		}
+	}
+	inp.ImageRes = 16
+	Run(inp, 0, 1000, 1000)
+	if errs > 0 {
+		t.Log("expected no errors, got: ", errs)
+		t.Error()
+	}
+}
+
+// TestOneBall compares 'balls 1' without a radius with not giving balls.
+func TestOneBall(t *testing.T) {
+	scene, err := ioutil.ReadFile("../geo/16_targets.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fatal := func(e error, a ...interface{}) {
+		if e != nil {
+			t.Fatal(append(a, e)...)
+		}
+	}
+	a := ParseInput(bytes.NewReader(scene), fatal)
+	b := ParseInput(bytes.NewReader(append(scene, "\nballs 1\n"...)), fatal)
+	a.ImageRes, b.ImageRes = 16, 16
+	ra, rb := Run(a, 0, 1000, 1000), Run(b, 0, 1000, 1000)
+
+	t.Log("expected:", a.Ball, ra.Measures, "got: ", b.Ball, rb.Measures)
+	if a.Ball != b.Ball || fmt.Sprint(ra.Measures, ra.Image) != fmt.Sprint(rb.Measures, rb.Image) {
+		t.Error()
+	}
+}
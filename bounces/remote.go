@@ -0,0 +1,215 @@
+package bounces
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// protocolVersion is increased whenever the messages between the
+// coordinator and the workers change.
+const protocolVersion = 2
+
+// ErrProtocol is returned by Work if the coordinator uses another version
+// of the protocol.
+var ErrProtocol = errors.New("the coordinator uses another version of the protocol")
+
+// A job is what a remote worker needs to simulate the blocks of a run, the
+// scene being sent as the text it is parsed from.
+type job struct {
+	Version    int
+	Scene      []byte
+	ImageRes   int
+	BlockSize  int
+	Batch      bool
+	Check      bool
+	LogMeasure string
+}
+
+// A task is a block for a remote worker to simulate.
+type task struct {
+	Seed int64
+}
+
+// A report is the counts of a block simulated by a remote worker, the image
+// being sent as the index and count of its non empty pixels.
+type report struct {
+	Version        int
+	Measures       []int64
+	Cases          []int64
+	Pixels         []int32
+	Counts         []int32
+	Violations     []Violation
+	ViolationCount int64
+	Logged         []Trajectory
+	LoggedCount    int64
+	Jammed         int64
+}
+
+// Coordinate is RunContext simulating the blocks on the remote workers, see
+// Work, whose connections are received on conns. The scene is the text inp
+// was parsed from. A block held by a worker whose connection fails is handed
+// out again, giving the same results as RunContext. If ctx is done while
+// no worker is left to simulate such a block it is dropped, and the results
+// are those of the blocks simulated, a checkpoint keeping it for a resume.
+func Coordinate(ctx context.Context, conns <-chan net.Conn, scene []byte, inp Input, prec float64, min, max int64) Results {
+	timeout := inp.BlockTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+	done := make(chan bool)
+	defer close(done)
+	return inp.run(ctx, prec, min, max, func(blocks chan block, size int, viol *violations, wg *sync.WaitGroup) {
+		j := job{protocolVersion, scene, inp.ImageRes, size, inp.Batch, inp.Check, inp.LogMeasure}
+		go func() {
+			for {
+				select {
+				case c := <-conns:
+					go j.serve(ctx, c, timeout, blocks, viol, wg)
+				case <-done:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// serve hands out blocks to the worker connected by c until the blocks
+// channel is closed or the connection fails, a worker not done with a block
+// within timeout being taken as failed.
+func (j job) serve(ctx context.Context, c net.Conn, timeout time.Duration, blocks chan block, viol *violations, wg *sync.WaitGroup) {
+	defer c.Close()
+	enc, dec := gob.NewEncoder(c), gob.NewDecoder(c)
+	c.SetDeadline(time.Now().Add(timeout))
+	if enc.Encode(j) != nil {
+		return
+	}
+	for b := range blocks {
+		rp := report{}
+		err := c.SetDeadline(time.Now().Add(timeout))
+		if err == nil {
+			err = enc.Encode(task{b.seed})
+		}
+		if err == nil {
+			err = dec.Decode(&rp)
+		}
+		if err != nil || !rp.valid(b, j.BlockSize) {
+			// give the block to another worker, if any is left
+			go func(b block) {
+				select {
+				case blocks <- b:
+				case <-ctx.Done():
+					// left pending, to be simulated on resume
+					wg.Done()
+				}
+			}(b)
+			return
+		}
+		rp.merge(b, j.BlockSize, viol)
+		wg.Done()
+	}
+}
+
+// valid returns whether the report can be of the block b of size
+// trajectories, such that merging it can not fail.
+func (rp report) valid(b block, size int) bool {
+	r := b.res
+	if rp.Version != protocolVersion || len(rp.Measures) != len(r.columns) || len(rp.Cases) != len(r.columns) ||
+		len(rp.Pixels) != len(rp.Counts) || len(rp.Logged) > maxLogged || rp.LoggedCount < int64(len(rp.Logged)) ||
+		len(rp.Violations) > maxViolations || rp.ViolationCount < int64(len(rp.Violations)) ||
+		rp.Jammed < 0 || rp.Jammed > int64(size) {
+		return false
+	}
+	for i := range rp.Measures {
+		if rp.Measures[i] < 0 || rp.Measures[i] > rp.Cases[i] {
+			return false
+		}
+	}
+	for i, p := range rp.Pixels {
+		if p < 0 || int(p) >= len(r.image.image) || rp.Counts[i] < 0 {
+			return false
+		}
+	}
+	for _, t := range rp.Logged {
+		if t.Seed != b.seed || t.Index < 0 || t.Index >= size {
+			return false
+		}
+	}
+	for _, v := range rp.Violations {
+		if v.Seed != b.seed || v.Index < 0 || v.Index >= size {
+			return false
+		}
+	}
+	return true
+}
+
+// merge is tally.merge for a report.
+func (rp report) merge(b block, size int, viol *violations) {
+	r := b.res
+	r.image.Lock()
+	defer r.image.Unlock()
+	r.Lock()
+	r.done(b.seed, size)
+	for i := range rp.Measures {
+		r.measures[i] += rp.Measures[i]
+		r.cases[i] += rp.Cases[i]
+	}
+	r.logged = firstTrajectories(append(r.logged, rp.Logged...))
+	r.logCount += rp.LoggedCount
+	r.jammed += rp.Jammed
+	r.Unlock()
+
+	for i, p := range rp.Pixels {
+		r.image.image[p] += rp.Counts[i]
+	}
+	viol.merge(rp.Violations, rp.ViolationCount)
+}
+
+// Work simulates the blocks handed out by a coordinator connected by c until
+// it closes the connection. Errors in the scene are reported to fatal.
+func Work(c net.Conn, fatal func(e error, a ...interface{})) error {
+	defer c.Close()
+	enc, dec := gob.NewEncoder(c), gob.NewDecoder(c)
+	j := job{}
+	if err := dec.Decode(&j); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if j.Version != protocolVersion {
+		return ErrProtocol
+	}
+	inp := ParseInput(bytes.NewReader(j.Scene), fatal)
+	inp.ImageRes, inp.Batch, inp.Check, inp.LogMeasure = j.ImageRes, j.Batch, j.Check, j.LogMeasure
+	inp.index()
+	res := allocateResults(1, inp)[0]
+	t := newTally(res)
+	for {
+		tk := task{}
+		if err := dec.Decode(&tk); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		viol := &violations{}
+		inp.simulateBlock(block{res, tk.Seed}, j.BlockSize, t, viol)
+
+		rp := report{Version: protocolVersion, Measures: t.measures, Cases: t.cases, Violations: viol.list, ViolationCount: viol.count,
+			Logged: t.logged, LoggedCount: t.logCount, Jammed: t.jammed}
+		t.drain(res.image.res, func(p int, c int32) {
+			rp.Pixels, rp.Counts = append(rp.Pixels, int32(p)), append(rp.Counts, c)
+		})
+		if err := enc.Encode(rp); err != nil {
+			return err
+		}
+		for i := range t.measures {
+			t.measures[i], t.cases[i] = 0, 0
+		}
+		t.logged, t.logCount, t.jammed = t.logged[:0], 0, 0
+	}
+}
@@ -0,0 +1,189 @@
+package bounces
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCoordinate(t *testing.T) {
+	scene, err := ioutil.ReadFile("../geo/04_geo_with.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inp := readScene(t, "../geo/04_geo_with.txt")
+	inp.ImageRes = 64
+	local := Run(inp, 0, 1000, 40000)
+
+	ln, conns := listenLocal(t)
+	defer ln.Close()
+	fatal := func(e error, a ...interface{}) {
+		if e != nil {
+			t.Error(append(a, e)...)
+		}
+	}
+
+	// a worker dying in its first block, and one reporting nonsense, before
+	// the others start
+	died := make(chan bool)
+	go func() {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		dec := gob.NewDecoder(c)
+		dec.Decode(&job{})
+		dec.Decode(&task{})
+		c.Close()
+
+		c, err = net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		dec, enc := gob.NewDecoder(c), gob.NewEncoder(c)
+		dec.Decode(&job{})
+		dec.Decode(&task{})
+		enc.Encode(report{Version: protocolVersion, Measures: make([]int64, len(local.Names)), Pixels: []int32{-5}, Counts: []int32{1}})
+		dec.Decode(&task{})
+		c.Close()
+		close(died)
+	}()
+	go func() {
+		<-died
+		for w := 0; w < 2; w++ {
+			go func() {
+				c, err := net.Dial("tcp", ln.Addr().String())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				Work(c, fatal)
+			}()
+		}
+	}()
+
+	remote := Coordinate(context.Background(), conns, scene, inp, 0, 1000, 40000)
+	t.Log("expected:", local.Samples, local.Measures, "got: ", remote.Samples, remote.Measures)
+	if fmt.Sprint(local.Measures, local.Samples, local.Image) != fmt.Sprint(remote.Measures, remote.Samples, remote.Image) {
+		t.Error()
+	}
+}
+
+// TestCoordinateStalled hands the block of a worker that stops answering to
+// another one once it timed out.
+func TestCoordinateStalled(t *testing.T) {
+	scene, err := ioutil.ReadFile("../geo/04_geo_with.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inp := readScene(t, "../geo/04_geo_with.txt")
+	inp.ImageRes = 64
+	local := Run(inp, 0, 1000, 40000)
+
+	ln, conns := listenLocal(t)
+	defer ln.Close()
+	stalled := make(chan bool)
+	go func() {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer c.Close()
+		dec := gob.NewDecoder(c)
+		dec.Decode(&job{})
+		dec.Decode(&task{})
+		close(stalled)
+		// hold the block, but do not close the connection
+		dec.Decode(&task{})
+	}()
+	go func() {
+		<-stalled
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		Work(c, func(e error, a ...interface{}) {
+			if e != nil {
+				t.Error(append(a, e)...)
+			}
+		})
+	}()
+
+	inp.BlockTimeout = 200 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	remote := Coordinate(ctx, conns, scene, inp, 0, 1000, 40000)
+	t.Log("expected:", local.Samples, local.Measures, "got: ", remote.Samples, remote.Measures, remote.Partial)
+	if remote.Partial || fmt.Sprint(local.Measures, local.Samples, local.Image) != fmt.Sprint(remote.Measures, remote.Samples, remote.Image) {
+		t.Error()
+	}
+}
+
+// TestCoordinateNoWorkers stops a coordinator whose only worker died, with
+// its block waiting to be handed out again.
+func TestCoordinateNoWorkers(t *testing.T) {
+	scene, err := ioutil.ReadFile("../geo/04_geo_with.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inp := readScene(t, "../geo/04_geo_with.txt")
+	inp.ImageRes = 64
+	ln, conns := listenLocal(t)
+	defer ln.Close()
+	go func() {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		dec := gob.NewDecoder(c)
+		dec.Decode(&job{})
+		dec.Decode(&task{})
+		c.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	res := Coordinate(ctx, conns, scene, inp, 0, 1000, 40000)
+	t.Log("expected: a partial result of no trajectories, got: ", res.Partial, res.Samples)
+	if !res.Partial || res.Samples != 0 {
+		t.Error()
+	}
+}
+
+// TestWorkVersion checks that a worker refuses a job of another version.
+func TestWorkVersion(t *testing.T) {
+	a, b := net.Pipe()
+	go gob.NewEncoder(a).Encode(job{Version: protocolVersion + 1})
+	if err := Work(b, nil); err != ErrProtocol {
+		t.Log("expected:", ErrProtocol, "got: ", err)
+		t.Error()
+	}
+}
+
+// listenLocal accepts connections on a local port, sending them on conns.
+func listenLocal(t *testing.T) (net.Listener, chan net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make(chan net.Conn)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- c
+		}
+	}()
+	return ln, conns
+}
@@ -0,0 +1,164 @@
+package bounces
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vron/bounces/line"
+	"github.com/vron/bounces/shape"
+)
+
+// maxLogged is the number of trajectories ending in the logged measure kept,
+// all are counted.
+const maxLogged = 100
+
+// A Trajectory identifies the Index:th trajectory of the block started from
+// Seed, such that Replay can simulate it again.
+type Trajectory struct {
+	Seed  int64
+	Index int
+}
+
+func (t Trajectory) String() string {
+	return fmt.Sprintf("%v:%v", t.Seed, t.Index)
+}
+
+// ParseTrajectory parses a trajectory written as by String, 'seed:index'.
+func ParseTrajectory(s string) (Trajectory, error) {
+	t := Trajectory{}
+	p := strings.Split(s, ":")
+	if len(p) != 2 {
+		return t, errors.New("expected a trajectory as seed:index, got '" + s + "'")
+	}
+	var err error
+	if t.Seed, err = strconv.ParseInt(p[0], 10, 64); err != nil {
+		return t, err
+	}
+	if t.Index, err = strconv.Atoi(p[1]); err != nil {
+		return t, err
+	}
+	if t.Index < 0 {
+		return t, errors.New("negative trajectory index in '" + s + "'")
+	}
+	return t, nil
+}
+
+// firstTrajectories sorts the trajectories by block seed and index, keeping
+// the first maxLogged such that which are kept does not depend on the order
+// the blocks finish in.
+func firstTrajectories(ts []Trajectory) []Trajectory {
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].Seed != ts[j].Seed {
+			return ts[i].Seed < ts[j].Seed
+		}
+		return ts[i].Index < ts[j].Index
+	})
+	if len(ts) > maxLogged {
+		ts = ts[:maxLogged]
+	}
+	return ts
+}
+
+// An Event is a point along a replayed trajectory where ball Ball started,
+// bounced, changed direction or stopped. The velocity is the one after the
+// event, Obstacle describes what was hit, if anything.
+type Event struct {
+	Kind     string
+	Ball     int
+	X, Y     float64
+	VX, VY   float64
+	Level    int
+	Obstacle string `json:",omitempty"`
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("%-6v ball %v at %.6g %.6g velocity %.6g %.6g", e.Kind, e.Ball, e.X, e.Y, e.VX, e.VY)
+	if e.Level != 0 {
+		s += fmt.Sprintf(" level %v", e.Level)
+	}
+	if e.Obstacle != "" {
+		s += ", " + e.Obstacle
+	}
+	return s
+}
+
+// event reports the event to the trace, if any.
+func (inp *Input) event(kind string, ball int, x, y, vx, vy float64, level int, o interface{}) {
+	if inp.trace == nil {
+		return
+	}
+	inp.trace(Event{kind, ball, x, y, vx, vy, level, describe(o)})
+}
+
+// describe writes the obstacle as it is given in a scene.
+func describe(o interface{}) string {
+	switch o := o.(type) {
+	case nil:
+		return ""
+	case line.Segment:
+		return fmt.Sprintf("line %g %g %g %g", o[0], o[1], o[0]+o[2], o[1]+o[3])
+	case shape.Circle:
+		return fmt.Sprintf("circle %g %g %g", o.X, o.Y, o.R)
+	case coated:
+		return describe(o.surface) + " with material"
+	case moving:
+		return "moving " + describe(o.shape)
+	}
+	return fmt.Sprint(o)
+}
+
+// A Path is a trajectory with its events and the names of the measures it
+// ended in.
+type Path struct {
+	Trajectory Trajectory
+	Events     []Event
+	Measures   []string
+}
+
+// Replay simulates the trajectory t of a run of the input again, returning
+// its events and the names of the measures it ended in.
+func (inp Input) Replay(t Trajectory) ([]Event, []string) {
+	p := inp.paths(t, 1)[0]
+	return p.Events, p.Measures
+}
+
+// Paths simulates the first n trajectories of the first block of a run of
+// the input, as a sample of what the run simulates.
+func (inp Input) Paths(n int) []Path {
+	seed := rand.New(rand.NewSource(inp.Seed)).Int63()
+	return inp.paths(Trajectory{seed, 0}, n)
+}
+
+// paths simulates n trajectories of the block of from, starting with from.
+func (inp Input) paths(from Trajectory, n int) []Path {
+	columns := inp.measures()
+	inp.index()
+	r := rand.New(rand.NewSource(from.Seed))
+	if inp.JitterBlock {
+		inp.Obstacles = inp.placeObstacles(r)
+		inp.index()
+	}
+	o := inp.newOutcome()
+	for i := 0; i < from.Index; i++ {
+		inp.trajectory(r, &o)
+	}
+	ps := make([]Path, n)
+	for i := range ps {
+		p := &ps[i]
+		p.Trajectory = Trajectory{from.Seed, from.Index + i}
+		inp.trace = func(e Event) {
+			p.Events = append(p.Events, e)
+		}
+		inp.trajectory(r, &o)
+		for _, m := range columns {
+			if hit, _ := m.count(&o); hit > 0 {
+				p.Measures = append(p.Measures, m.Name)
+			}
+		}
+	}
+	return ps
+}
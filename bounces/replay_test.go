@@ -0,0 +1,120 @@
+package bounces
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestParseTrajectory(t *testing.T) {
+	id := Trajectory{-42, 17}
+	got, err := ParseTrajectory(id.String())
+	t.Log("expected:", id, "got: ", got, err)
+	if err != nil || got != id {
+		t.Error()
+	}
+	for _, s := range []string{"", "1", "1:", "a:1", "1:-1", "1:2:3"} {
+		if _, err := ParseTrajectory(s); err == nil {
+			t.Log("expected an error for", s)
+			t.Error()
+		}
+	}
+}
+
+// TestReplay replays the trajectories logged by a run, with and without the
+// batch kernel, which must end in the logged measure.
+func TestReplay(t *testing.T) {
+	inp := readScene(t, "../geo/16_targets.txt")
+	inp.ImageRes = 64
+	inp.Seed, inp.Replicates = 3, 2
+	inp.LogMeasure = "corner"
+	for _, batch := range []bool{false, true} {
+		inp.Batch = batch
+		res := Run(inp, 0, 2000, 2000)
+		if len(res.Logged) == 0 || res.LoggedCount < int64(len(res.Logged)) {
+			t.Log("expected logged trajectories, got:", res.LoggedCount, res.Logged)
+			t.Error()
+		}
+		for _, id := range res.Logged {
+			events, in := inp.Replay(id)
+			if len(in) == 0 || in[0] != "corner" || events[len(events)-1].Kind != "stop" {
+				t.Log("expected:", id, "to end in corner, got: ", in, events[len(events)-1])
+				t.Error()
+			}
+		}
+	}
+}
+
+// TestReplayEvents compares the end of replayed trajectories with the
+// outcome of simulating them.
+func TestReplayEvents(t *testing.T) {
+	inp := readScene(t, "../geo/04_geo_with.txt")
+	inp.index()
+	r := rand.New(rand.NewSource(5))
+	o := inp.newOutcome()
+	for i := 0; i < 50; i++ {
+		inp.trajectory(r, &o)
+		events, _ := inp.Replay(Trajectory{5, i})
+		e := events[len(events)-1]
+		if e.X != o.x[0] || e.Y != o.y[0] || events[0].Kind != "start" {
+			t.Log("expected:", o.x[0], o.y[0], "got: ", e)
+			t.Error()
+		}
+	}
+}
+
+// TestPaths compares the sampled paths with replaying them one by one, and
+// checks the size of the images drawn of them.
+func TestPaths(t *testing.T) {
+	inp := readScene(t, "../geo/16_targets.txt")
+	inp.ImageRes = 32
+	ps := inp.Paths(20)
+	for _, p := range ps {
+		events, in := inp.Replay(p.Trajectory)
+		if fmt.Sprint(events, in) != fmt.Sprint(p.Events, p.Measures) {
+			t.Log("expected:", events, in, "got: ", p.Events, p.Measures)
+			t.Error()
+		}
+	}
+
+	res := Run(inp, 0, 1000, 1000)
+	for _, beside := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		if err := res.DrawPaths(buf, math.Log1p, inp, ps, BySpeed, beside); err != nil {
+			t.Fatal(err)
+		}
+		m, err := png.Decode(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := 32
+		if beside {
+			w = 64
+		}
+		if b := m.Bounds(); b.Dx() != w || b.Dy() != 32 {
+			t.Log("expected:", w, 32, "got: ", b)
+			t.Error()
+		}
+	}
+}
+
+func TestParsePathColor(t *testing.T) {
+	for _, c := range []PathColor{ByMeasure, BySpeed} {
+		got, err := ParsePathColor(c.String())
+		t.Log("expected:", c, "got: ", got, err)
+		if got != c || err != nil {
+			t.Error()
+		}
+	}
+	if _, err := ParsePathColor("rainbow"); err == nil {
+		t.Log("expected: an error got: ", err)
+		t.Error()
+	}
+	if s := PathColor(7).String(); s != "PathColor(7)" {
+		t.Log("expected:", "PathColor(7)", "got: ", s)
+		t.Error()
+	}
+}
@@ -0,0 +1,137 @@
+package bounces
+
+import (
+	"errors"
+	"math"
+
+	"github.com/vron/bounces/line"
+	"github.com/vron/bounces/shape"
+)
+
+// A Room is a polygon x0 y0 x1 y1 ... of walls, which are opened where a
+// doorway lies on them. Friction scales the friction of the object while it
+// rolls in the room, e.g. 2 for a carpet twice as rough as the default.
+type Room struct {
+	Name     string
+	Outline  []float64
+	Friction float64
+}
+
+// contains is the same test as for a level.
+func (r Room) contains(x, y float64) bool {
+	return Level{Outline: r.Outline}.contains(x, y)
+}
+
+// roomAt returns the index of the first room containing (x, y), or -1.
+func (inp Input) roomAt(x, y float64) int {
+	for ri, r := range inp.Rooms {
+		if r.contains(x, y) {
+			return ri
+		}
+	}
+	return -1
+}
+
+// roomFriction returns the friction factor at (x, y).
+func (inp Input) roomFriction(x, y float64) float64 {
+	if ri := inp.roomAt(x, y); ri >= 0 {
+		return inp.Rooms[ri].Friction
+	}
+	return 1
+}
+
+// doorway returns the distance along the path, curving with k, at which the
+// ball passes through a doorway, or +Inf.
+func (inp Input) doorway(x, y, vx, vy, k float64) float64 {
+	d, _ := crossing(inp.Doors, x, y, vx, vy, k)
+	return d
+}
+
+// roomWalls adds the walls of all rooms as obstacles, leaving out the parts
+// covered by a doorway.
+func (i *Input) roomWalls() {
+	for _, r := range i.Rooms {
+		for _, e := range (Level{Outline: r.Outline}).edges() {
+			for _, p := range i.wallParts(e) {
+				if p[1]-p[0] < doorTol {
+					continue
+				}
+				x0, y0 := e[0]+p[0]*e[2], e[1]+p[0]*e[3]
+				x1, y1 := e[0]+p[1]*e[2], e[1]+p[1]*e[3]
+				i.Obstacles = append(i.Obstacles, line.SegmentFromPoints(x0, y0, x1, y1))
+				i.Obstacles = append(i.Obstacles, shape.NewCircle(x0, y0, 0))
+				i.Obstacles = append(i.Obstacles, shape.NewCircle(x1, y1, 0))
+			}
+		}
+	}
+	for len(i.Layers) < len(i.Obstacles) {
+		i.Layers = append(i.Layers, 0)
+	}
+}
+
+// wallParts returns the intervals, as parameters along the edge, which remain
+// walls once the doorways on the edge are cut away.
+func (i *Input) wallParts(e line.Segment) [][2]float64 {
+	parts := [][2]float64{{0, 1}}
+	l2 := e[2]*e[2] + e[3]*e[3]
+	for _, door := range i.Doors {
+		var s [2]float64
+		collinear := true
+		for k, p := range [2][2]float64{{door[0], door[1]}, {door[0] + door[2], door[1] + door[3]}} {
+			dx, dy := p[0]-e[0], p[1]-e[1]
+			if math.Abs(dx*e[3]-dy*e[2])/math.Sqrt(l2) > doorTol {
+				collinear = false
+			}
+			s[k] = (dx*e[2] + dy*e[3]) / l2
+		}
+		if !collinear {
+			continue
+		}
+		a, b := math.Min(s[0], s[1]), math.Max(s[0], s[1])
+		left := [][2]float64{}
+		for _, p := range parts {
+			if p[0] < a {
+				left = append(left, [2]float64{p[0], math.Min(p[1], a)})
+			}
+			if p[1] > b {
+				left = append(left, [2]float64{math.Max(p[0], b), p[1]})
+			}
+		}
+		parts = left
+	}
+	return parts
+}
+
+// doorTol is how far a doorway may be from a wall and still open it.
+const doorTol = 1e-6
+
+type parseRoom struct{}
+
+// Handle takes care of 'room name x0 y0 x1 y1 ... [friction f]' as well as
+// 'door x0 y0 x1 y1'.
+func (p parseRoom) Handle(d []string, i *Input) bool {
+	switch d[0] {
+	case "room":
+		if len(d) < 2 {
+			i.Error(errors.New(""), "room expects a name and 2 or more points")
+		}
+		r := Room{Name: d[1], Friction: 1}
+		if n := len(d); n > 2 && d[n-2] == "friction" {
+			r.Friction = i.num(d[n-1])
+			d = d[:n-2]
+		}
+		r.Outline = i.polygon("room", d[2:])
+		if r.Friction < 0 {
+			i.Error(errors.New(""), "room friction is a factor and can not be negative")
+		}
+		i.Rooms = append(i.Rooms, r)
+	case "door":
+		if len(d) != 5 {
+			i.Error(errors.New(""), "door expects 4 arguments")
+		}
+		i.Doors = append(i.Doors, line.SegmentFromPoints(i.num(d[1]), i.num(d[2]), i.num(d[3]), i.num(d[4])))
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package bounces
+
+import (
+	"math"
+	"testing"
+)
+
+// roomsScene has a hall and a rougher room beside it, joined by a door.
+const roomsScene = `ball 0.02
+velocity uniform 1 1
+friction -0.5
+terminal 0.01
+elasticity 0.5
+start 1 1
+
+room hall 0 0 2 2
+room rough 2 0 6 2 friction 3
+door 2 0.5 2 1.5
+
+measure all 0 0 6 2
+`
+
+func TestRoomAt(t *testing.T) {
+	inp := parseScene(t, roomsScene)
+	for _, c := range []struct {
+		x, y float64
+		room int
+		f    float64
+	}{{1, 1, 0, 1}, {3, 1, 1, 3}, {7, 1, -1, 1}} {
+		ri, f := inp.roomAt(c.x, c.y), inp.roomFriction(c.x, c.y)
+		t.Log("expected:", c.room, c.f, "got: ", ri, f)
+		if ri != c.room || f != c.f {
+			t.Error()
+		}
+	}
+}
+
+func TestDoor(t *testing.T) {
+	inp := parseScene(t, roomsScene)
+	doors := 0
+	inp.trace = func(e Event) {
+		if e.Kind == "door" {
+			doors++
+		}
+	}
+
+	// one unit in the hall and the rest three times as rough
+	v, f := 2.0, 0.5
+	v1 := v*v - 2*f*1
+	exp := 2 + (v1-inp.Terminal*inp.Terminal)/(2*3*f)
+	x, _, _ := throw(inp, v, 0)
+	t.Log("expected:", exp, 1, "got: ", x, doors)
+	if math.Abs(x-exp) > 1e-6 || doors != 1 {
+		t.Error()
+	}
+
+	// as far as in the hall with no rough room
+	inp.Rooms[1].Friction = 1
+	exp = 1 + (v*v-inp.Terminal*inp.Terminal)/(2*f)
+	x, _, _ = throw(inp, v, 0)
+	t.Log("expected:", exp, "got: ", x)
+	if math.Abs(x-exp) > 1e-6 {
+		t.Error()
+	}
+
+	// beside the door there is a wall
+	doors = 0
+	inp.Start = [2]float64{1, 0.25}
+	x, _, _ = throw(inp, v, 0)
+	t.Log("expected in the hall, got: ", x, doors)
+	if x > 2-inp.Ball || doors != 0 {
+		t.Error()
+	}
+}
@@ -1,50 +1,142 @@
 package bounces
 
 import (
+	"context"
+	"errors"
 	"math"
 	"math/rand"
+	"os"
 	"runtime"
 	"sync"
-
-	"github.com/gonum/stat"
+	"time"
 )
 
+// Run simulates between min and max trajectories, stopping once the
+// intervals of all measures are within their targets. prec is the target
+// half width for the measures without one of their own. Being the half
+// width of the interval at the level Confidence, rather than the standard
+// error, it takes about four times as many trajectories to reach at 95% as
+// the same standard error would.
 func Run(inp Input, prec float64, min, max int64) Results {
+	return RunContext(context.Background(), inp, prec, min, max)
+}
+
+// RunContext is Run stopping early, once the blocks being simulated are
+// done, if ctx is done. The results are then marked as Partial.
+func RunContext(ctx context.Context, inp Input, prec float64, min, max int64) Results {
+	return inp.run(ctx, prec, min, max, func(blocks chan block, size int, viol *violations, wg *sync.WaitGroup) {
+		workers := inp.Workers
+		if workers < 1 {
+			workers = runtime.NumCPU()
+		}
+		for w := 0; w < workers; w++ {
+			go inp.work(blocks, size, viol, wg)
+		}
+	})
+}
+
+// run hands out the blocks to the workers started by start, each calling
+// wg.Done once a block is merged into its result.
+func (inp Input) run(ctx context.Context, prec float64, min, max int64, start func(blocks chan block, size int, viol *violations, wg *sync.WaitGroup)) Results {
 
 	// run a set of simulations, calculating both the measures ans the distribution image.
-	// we always want 5 independent simulations for the measures such that
-	// we can calculate the standard errors. The distribution image we simply
+	// we want a number of independent simulations for the measures such that
+	// we can calculate the errors by batch means. The distribution image we simply
 	// accumulate all to smooth as much as possible
 
-	nos := 5
+	nos := inp.Replicates
+	if nos < 1 {
+		nos = 5
+	}
+	if inp.Confidence <= 0 || inp.Confidence >= 1 {
+		inp.Confidence = 0.95
+	}
 	var blockSize = int(10000)
 	if int(min) < blockSize {
 		blockSize = int(min)
 	}
 
-	r := rand.New(rand.NewSource(0))
+	seed, drawn := inp.Seed, int64(0)
+	r := rand.New(rand.NewSource(seed))
 	res := allocateResults(nos, inp)
-	queue := make(chan bool, runtime.NumCPU())
+	if inp.LogMeasure != "" && res[0].log < 0 {
+		inp.Error(errors.New("no measure named '"+inp.LogMeasure+"'"), "logging trajectories:")
+		return Results{}
+	}
+	inp.index()
+	viol := &violations{}
+	var resend [][]int64
+	if inp.Resume {
+		c, err := loadCheckpoint(inp.Checkpoint)
+		if err == nil {
+			err = c.restore(inp, res, seed, blockSize, viol)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			inp.Error(err, "resuming from "+inp.Checkpoint+":")
+			return Results{}
+		}
+		for ; drawn < c.Drawn; drawn++ {
+			r.Int63()
+		}
+		resend = c.Pending
+	}
+	partial := false
+	save := func() {
+		if inp.Checkpoint == "" {
+			return
+		}
+		err := inp.snapshot(res, seed, viol, drawn, blockSize).save(inp.Checkpoint)
+		inp.Error(err, "saving checkpoint:")
+	}
+	saved := time.Now()
+	blocks := make(chan block)
 	wg := sync.WaitGroup{}
+	start(blocks, blockSize, viol, &wg)
+	defer close(blocks)
 
-	for targetSamples := int64(blockSize); true; targetSamples *= 2 {
+	// send hands out the block, which stays pending if ctx is done first
+	send := func(sample *result, seed int64) bool {
+		if inp.CheckpointEvery > 0 && time.Since(saved) >= inp.CheckpointEvery {
+			save()
+			saved = time.Now()
+		}
+		sample.Lock()
+		sample.pending = append(sample.pending, seed)
+		sample.Unlock()
+		wg.Add(1)
+		select {
+		case blocks <- block{sample, seed}:
+			return true
+		case <-ctx.Done():
+			wg.Done()
+			return false
+		}
+	}
+	for i, seeds := range resend {
+		for _, s := range seeds {
+			if ctx.Err() != nil || !send(res[i], s) {
+				partial = true
+				break
+			}
+		}
+	}
 
+Blocks:
+	for targetSamples := int64(blockSize); !partial; targetSamples *= 2 {
 		for _, sample := range res {
-			notr := targetSamples - sample.no
+			notr := targetSamples - sample.handed(blockSize)
 			notr = notr / int64(blockSize)
 			for i := int64(0); i < notr; i++ {
-
-				// start workers in blocks of blockSize until we have sufficient ones
-				queue <- true
-				wg.Add(1)
-				go func(res *result, r *rand.Rand) {
-					for i := 0; i < blockSize; i++ {
-						x, y, _ := inp.simulate(r)
-						res.addPos(x, y)
-					}
-					<-queue
-					wg.Done()
-				}(sample, rand.New(rand.NewSource(r.Int63())))
+				// hand out blocks of blockSize until we have sufficient ones
+				if ctx.Err() != nil {
+					partial = true
+					break Blocks
+				}
+				drawn++
+				if !send(sample, r.Int63()) {
+					partial = true
+					break Blocks
+				}
 			}
 		}
 		wg.Wait()
@@ -58,41 +150,67 @@ func Run(inp Input, prec float64, min, max int64) Results {
 		if int64(nos)*targetSamples >= max {
 			break
 		}
-		_, maxErr := calculateActualResults(res)
-		if maxErr <= prec {
+		if rr := inp.calculateActualResults(res, seed, viol, prec); rr.Converged {
 			break
 		}
 	}
 
-	rr, _ := calculateActualResults(res)
+	wg.Wait()
+	save()
+	for _, sample := range res {
+		// blocks given up without being simulated
+		partial = partial || len(sample.pending) > 0
+	}
+	rr := inp.calculateActualResults(res, seed, viol, prec)
+	rr.Partial = partial
 	return rr
 }
 
 type Results struct {
-	Measures      []float64
+	Names    []string
+	Measures []float64
+	// MeasureErrors is half the width of the interval [Lower, Upper] that
+	// holds each measure with the probability Confidence, computed with the
+	// method Interval from the trajectories of all Replicates.
 	MeasureErrors []float64
+	Lower, Upper  []float64
+	Confidence    float64
+	Interval      Interval
+	Replicates    int
 	Image         []int32
-}
 
-func calculateActualResults(results []*result) (Results, float64) {
-	r := Results{
-		Image: results[0].image.image,
-	}
+	// Targets is the half width wanted for each measure, ReportOnly marks
+	// the measures not considered. Limiting is the index of the measure
+	// furthest from its target, -1 if none, and Converged tells if all
+	// targets were reached when the run stopped.
+	Targets    []float64
+	ReportOnly []bool
+	Limiting   int
+	Converged  bool
 
-	maxErr := 0.0
-	for mi := range results[0].measures {
-		vals := make([]float64, 0, len(results))
-		for _, r := range results {
-			vals = append(vals, float64(r.measures[mi])/float64(r.no))
-		}
-		r.Measures = append(r.Measures, stat.Mean(vals, nil))
-		v := stat.StdErr(stat.StdDev(vals, nil), float64(len(results)))
-		r.MeasureErrors = append(r.MeasureErrors, v)
-		if v > maxErr {
-			maxErr = v
-		}
-	}
-	return r, maxErr
+	// Samples is the number of trajectories simulated, Partial is set if
+	// the run was stopped by its context. Jammed of the trajectories got
+	// stuck, e.g. in a wedge, and are in neither the measures nor the image.
+	Samples int64
+	Partial bool
+	Jammed  int64
+
+	// Violations holds examples of the ViolationCount broken invariants
+	// found if the input had Check set.
+	Violations     []Violation
+	ViolationCount int64
+
+	// Logged holds the first of the LoggedCount trajectories ending in the
+	// measure named by LogMeasure of the input.
+	Logged      []Trajectory
+	LoggedCount int64
+
+	// Counts are what the results were computed from.
+	Counts Counts
+}
+
+func (inp Input) calculateActualResults(results []*result, seed int64, viol *violations, prec float64) Results {
+	return inp.counts(results, seed, viol).Results(inp.Interval, inp.Confidence, prec)
 }
 
 func allocateResults(nos int, inp Input) []*result {
@@ -101,42 +219,56 @@ func allocateResults(nos int, inp Input) []*result {
 		res:   inp.ImageRes,
 	}
 	img.bounds[0], img.bounds[1], img.bounds[2], img.bounds[3] = inp.bounds()
+	columns := inp.measures()
+	log := -1
+	for i, m := range columns {
+		if inp.LogMeasure != "" && m.Name == inp.LogMeasure {
+			log = i
+		}
+	}
 	results := make([]*result, 0, nos)
 	for i := 0; i < nos; i++ {
-		res := &result{
-			input: &inp,
-			image: img,
-		}
-
-		for range inp.Measures {
-			res.measures = append(res.measures, 0)
-		}
-		results = append(results, res)
+		results = append(results, &result{
+			columns:  columns,
+			measures: make([]int64, len(columns)),
+			cases:    make([]int64, len(columns)),
+			image:    img,
+			log:      log,
+		})
 	}
 	return results
 }
 
+// bounds returns the bounds of all places the obstacles, jittered or
+// moving, can be in.
 func (inp Input) bounds() (x, y, w, h float64) {
-	xm, xM := math.MaxFloat64, -math.MaxFloat64
-	ym, yM := math.MaxFloat64, -math.MaxFloat64
+	boxes := make([][4]float64, 0, len(inp.Obstacles)+len(inp.Movers))
 	for _, o := range inp.Obstacles {
 		x, y, w, h := o.Bounds()
-		if x < xm {
-			xm = x
-		}
-		if y < ym {
-			ym = y
-		}
-		if x+w > xM {
-			xM = x + w
-		}
-		if y+h > yM {
-			yM = y + h
+		boxes = append(boxes, [4]float64{x, y, x + w, y + h})
+	}
+	for _, j := range inp.Jitters {
+		for oi := j.From; oi < j.To && oi < len(boxes); oi++ {
+			boxes[oi] = j.widen(boxes[oi])
 		}
 	}
+	for _, m := range inp.Movers {
+		x, y, w, h := m.Bounds()
+		boxes = append(boxes, [4]float64{x, y, x + w, y + h})
+	}
+	xm, xM := math.MaxFloat64, -math.MaxFloat64
+	ym, yM := math.MaxFloat64, -math.MaxFloat64
+	for _, b := range boxes {
+		xm, ym = math.Min(xm, b[0]), math.Min(ym, b[1])
+		xM, yM = math.Max(xM, b[2]), math.Max(yM, b[3])
+	}
 	return xm, ym, xM - xm, yM - ym
 }
 
+// tileSize is the side, in pixels, of the image tiles a worker marks as
+// touched so that only those are merged.
+const tileSize = 64
+
 type image struct {
 	sync.Mutex
 	bounds [4]float64
@@ -145,29 +277,211 @@ type image struct {
 }
 
 type result struct {
-	input *Input
+	columns []measure
 
 	sync.Mutex
 	measures []int64
+	cases    []int64
 	image    *image
-	no       int64
+	// no is the number of trajectories merged, pending holds the seeds of
+	// the blocks handed out but not merged
+	no      int64
+	pending []int64
+
+	// logged holds the first of the logCount trajectories ending in the
+	// column log, if not negative
+	log      int
+	logged   []Trajectory
+	logCount int64
+
+	// jammed is the number of trajectories not counted as they got stuck
+	jammed int64
+}
+
+// A block is a number of trajectories to add to a result, simulated from
+// seed.
+type block struct {
+	res  *result
+	seed int64
+}
+
+// work simulates blocks until the channel is closed. Each worker counts into
+// its own tally and only merges it into the shared result at the end of a
+// block.
+func (inp Input) work(blocks chan block, size int, viol *violations, wg *sync.WaitGroup) {
+	var t *tally
+	for b := range blocks {
+		if t == nil {
+			t = newTally(b.res)
+		}
+		v := &violations{}
+		inp.simulateBlock(b, size, t, v)
+		t.merge(b, size, v, viol)
+		wg.Done()
+	}
 }
 
-func (r *result) addPos(x, y float64) {
-	r.image.addPos(x, y)
+// handed returns the number of trajectories of the blocks handed out.
+func (r *result) handed(size int) int64 {
 	r.Lock()
 	defer r.Unlock()
+	return r.no + int64(len(r.pending)*size)
+}
+
+// done counts the block of size trajectories as merged, r being locked.
+func (r *result) done(seed int64, size int) {
+	r.no += int64(size)
+	for i, s := range r.pending {
+		if s == seed {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			return
+		}
+	}
+}
 
-	for i, in := range r.input.Measures {
-		if x < in.X || x > in.X+in.W || y < in.Y || y > in.Y+in.H {
+// simulateBlock counts the trajectories of a block into t.
+func (inp Input) simulateBlock(b block, size int, t *tally, viol *violations) {
+	r := rand.New(rand.NewSource(b.seed))
+	if inp.JitterBlock {
+		inp.Obstacles = inp.placeObstacles(r)
+		inp.index()
+	}
+	o := inp.newOutcome()
+	i := 0
+	if inp.Check {
+		inp.check.report = func(kind string, bounce int, x, y float64, detail string) {
+			viol.add(Violation{kind, Trajectory{b.seed, i}, bounce, x, y, detail})
+		}
+	}
+	if inp.Batch && inp.batchable() {
+		k := inp.newKernel()
+		for ; i < size; i += batchSize {
+			n := size - i
+			if n > batchSize {
+				n = batchSize
+			}
+			k.run(inp, r, n)
+			for j := 0; j < n; j++ {
+				o.x[0], o.y[0], o.kind[0], o.level[0] = k.x[j], k.y[j], k.kind[j], 0
+				if t.add(b.res, &o) {
+					t.log(Trajectory{b.seed, i + j})
+				}
+			}
+		}
+	}
+	for ; i < size; i++ {
+		if !inp.trajectory(r, &o) {
+			// stuck, e.g. in a wedge, which is no place to count
+			t.jammed++
 			continue
 		}
-		r.measures[i]++
+		if t.add(b.res, &o) {
+			t.log(Trajectory{b.seed, i})
+		}
+	}
+}
+
+// A tally is the counts of one worker not yet merged into a result.
+type tally struct {
+	measures []int64
+	cases    []int64
+	image    []int32
+	tiles    []bool
+	logged   []Trajectory
+	logCount int64
+	jammed   int64
+}
+
+func newTally(r *result) *tally {
+	n := (r.image.res + tileSize - 1) / tileSize
+	return &tally{
+		measures: make([]int64, len(r.columns)),
+		cases:    make([]int64, len(r.columns)),
+		image:    make([]int32, len(r.image.image)),
+		tiles:    make([]bool, n*n),
 	}
-	r.no++
 }
 
-func (r *image) addPos(x, y float64) {
+// add counts the outcome, returning whether it is in the logged measure.
+func (t *tally) add(r *result, o *outcome) bool {
+	logged := false
+	n := (r.image.res + tileSize - 1) / tileSize
+	for bi := range o.x {
+		xi, yi := r.image.pixel(o.x[bi], o.y[bi])
+		t.image[xi+r.image.res*yi]++
+		t.tiles[xi/tileSize+n*(yi/tileSize)] = true
+	}
+	for i, m := range r.columns {
+		hit, of := m.count(o)
+		t.measures[i] += int64(hit)
+		t.cases[i] += int64(of)
+		logged = logged || (i == r.log && hit > 0)
+	}
+	return logged
+}
+
+// log records a trajectory ending in the logged measure, the first ones of a
+// block being those with the lowest index.
+func (t *tally) log(id Trajectory) {
+	t.logCount++
+	if len(t.logged) < maxLogged {
+		t.logged = append(t.logged, id)
+	}
+}
+
+// merge adds the tally, and the violations v, of the block b of size
+// trajectories to its result and clears it. The image is locked throughout
+// such that a snapshot holds all of a block or nothing of it.
+func (t *tally) merge(b block, size int, v, viol *violations) {
+	r := b.res
+	img := r.image
+	img.Lock()
+	defer img.Unlock()
+	r.Lock()
+	r.done(b.seed, size)
+	for i := range t.measures {
+		r.measures[i] += t.measures[i]
+		r.cases[i] += t.cases[i]
+		t.measures[i], t.cases[i] = 0, 0
+	}
+	if t.logCount > 0 {
+		r.logged = firstTrajectories(append(r.logged, t.logged...))
+		r.logCount += t.logCount
+		t.logged, t.logCount = t.logged[:0], 0
+	}
+	r.jammed += t.jammed
+	t.jammed = 0
+	r.Unlock()
+
+	t.drain(img.res, func(p int, c int32) {
+		img.image[p] += c
+	})
+	viol.merge(v.list, v.count)
+}
+
+// drain calls f with the count c of every touched pixel p of the image of
+// resolution res, clearing them.
+func (t *tally) drain(res int, f func(p int, c int32)) {
+	n := (res + tileSize - 1) / tileSize
+	for ti, touched := range t.tiles {
+		if !touched {
+			continue
+		}
+		t.tiles[ti] = false
+		x0, y0 := (ti%n)*tileSize, (ti/n)*tileSize
+		for y := y0; y < y0+tileSize && y < res; y++ {
+			for x := x0; x < x0+tileSize && x < res; x++ {
+				if p := x + res*y; t.image[p] != 0 {
+					f(p, t.image[p])
+					t.image[p] = 0
+				}
+			}
+		}
+	}
+}
+
+// pixel returns the pixel of the image containing (x, y).
+func (r *image) pixel(x, y float64) (int, int) {
 	// find the grid position where this should be drawn
 	res := r.res
 	x -= r.bounds[0]
@@ -180,13 +494,5 @@ func (r *image) addPos(x, y float64) {
 	y /= m
 	xi := int(x * float64(res))
 	yi := int(y * float64(res))
-	if xi >= res {
-		xi = res - 1
-	}
-	if yi >= res {
-		yi = res - 1
-	}
-	r.Lock()
-	r.image[xi+res*yi]++
-	r.Unlock()
+	return clamp(xi, res), clamp(yi, res)
 }
@@ -0,0 +1,62 @@
+package bounces
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// BenchmarkRun measures how Run scales with the number of workers, each
+// iteration being one run of a fixed number of trajectories.
+func BenchmarkRun(b *testing.B) {
+	inp := readScene(b, "../geo/04_geo_with.txt")
+	inp.ImageRes = 256
+	const n = 5 * 10000 * 4
+	for w := 1; ; w *= 2 {
+		if w > runtime.NumCPU() {
+			w = runtime.NumCPU()
+		}
+		inp.Workers = w
+		b.Run(fmt.Sprint("workers=", w), func(b *testing.B) {
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				Run(inp, 0, n, n)
+			}
+			b.ReportMetric(float64(b.N)*n/time.Since(start).Seconds(), "trajectories/s")
+		})
+		if w == runtime.NumCPU() {
+			break
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	inp := readScene(t, "../geo/04_geo_with.txt")
+	inp.ImageRes = 64
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	res := RunContext(ctx, inp, 0, 1000, 1e9)
+
+	t.Log("expected:", true, "got: ", res.Partial, res.Samples, res.Measures)
+	if !res.Partial || res.Samples < 5000 || res.Samples >= 1e9 || res.Measures[0] <= 0 {
+		t.Error()
+	}
+}
+
+func TestSeed(t *testing.T) {
+	inp := readScene(t, "../geo/04_geo_with.txt")
+	inp.ImageRes = 64
+	inp.Seed, inp.Workers = 7, 1
+	a := Run(inp, 0, 1000, 20000)
+	inp.Workers = 4
+	b := Run(inp, 0, 1000, 20000)
+	inp.Seed = 8
+	c := Run(inp, 0, 1000, 20000)
+
+	t.Log("expected:", a.Measures, "got: ", b.Measures, "and not", c.Measures)
+	if fmt.Sprint(a.Measures, a.Image) != fmt.Sprint(b.Measures, b.Image) || a.Measures[0] == c.Measures[0] {
+		t.Error()
+	}
+}
@@ -8,82 +8,219 @@ import (
 )
 
 const maxBounce = 1000
+const tol = 1e-8
+const contactSpeed = 5e-3
+const maxSteps = 100 * maxBounce
 
-func debug(f string, a ...interface{}) {
-	return
-	fmt.Printf(f+"\n", a...)
+// maxJam is the number of bounces without moving after which the ball is
+// considered to be jammed between obstacles, e.g. in a narrowing wedge.
+const maxJam = 100
+
+// trajectory simulates one throw, storing the final positions in o.
+func (inp Input) trajectory(r *rand.Rand, o *outcome) bool {
+	if len(inp.Jitters) > 0 && !inp.JitterBlock {
+		inp.Obstacles = inp.placeObstacles(r)
+	}
+	if len(inp.Balls) > 1 {
+		return inp.simulateMany(r, o)
+	}
+	var ok bool
+	inp.Object, o.kind[0] = inp.drawObject(r)
+	o.x[0], o.y[0], o.level[0], ok = inp.simulate(r)
+	return ok
 }
 
-func (inp Input) simulate(r *rand.Rand) (float64, float64, bool) {
-	debug("\n\nstart")
+// simulate throws a single ball, returning where, and on which level, it
+// stopped.
+func (inp Input) simulate(r *rand.Rand) (float64, float64, int, bool) {
 	x, y := inp.Start[0], inp.Start[1]
+	level, all := inp.StartLevel, inp.Obstacles
+	if inp.check.on() {
+		inp.check.start(inp)
+	}
+	inp.Obstacles = inp.onLevel(all, level)
+	friction := inp.Friction
+	inp.Friction = friction * inp.roomFriction(x, y)
 	vx, vy := inp.randInitial(r)
+	curl := inp.curl(r)
 
-	//v0 := math.Sqrt(vx*vx + vy*vy)
 	i := 0
-	tdist := 0.0
-	//defer func() {
-	//	println(v0, i, tdist)
-	//}()
-	for ; i < maxBounce; i++ {
-		debug("pos         %+.3f %+.3f %+.3f %+.3f", x, y, vx, vy)
+	t, wandered := 0.0, 0.0
+	jam := 0
+	inp.event("start", 0, x, y, vx, vy, level, nil)
+	if inp.Drop.Height > 0 {
+		x, y, vx, vy, t = inp.fall(r, inp.Drop.Height, x, y, vx, vy)
+		inp.event("land", 0, x, y, vx, vy, level, nil)
+	}
+	for steps := 0; i < maxBounce && steps < maxSteps; steps++ {
 		if inp.stopped(vx, vy) {
-			return x, y, true
+			inp.event("stop", 0, x, y, 0, 0, level, nil)
+			return x, y, level, true
 		}
 
-		ox, oy := x, y
-		dist, obstacle := inp.closesObstacle(x, y, vx, vy)
-		debug(" - closest: %+.3f", dist)
+		v0, k := math.Sqrt(vx*vx+vy*vy), 0.0
+		var dist float64
+		var obstacle Obstacle
+		var mover MovingObstacle
+		if curl != 0 {
+			k = curl / v0
+			dist, obstacle = inp.closestArc(x, y, vx, vy, k)
+		} else {
+			dist, obstacle = inp.closesObstacle(x, y, vx, vy, inp.Ball)
+		}
+		edge := inp.levelEdge(level, x, y, vx, vy, k)
+		if edge < dist {
+			dist, obstacle = edge, nil
+		}
+		door := inp.doorway(x, y, vx, vy, k)
+		if door < dist {
+			dist, obstacle = door, nil
+		}
+		seam, si := inp.seam(x, y, vx, vy, k)
+		if seam < dist {
+			dist, obstacle = seam, nil
+		}
+		if step := inp.wanderStep(); step < dist {
+			dist, obstacle = step, nil
+		}
+		if len(inp.Movers) > 0 {
+			dist, mover = inp.closestMover(t, dist, x, y, vx, vy)
+		}
+		if math.IsInf(dist, 1) {
+			inp.Error(errors.New("did not collie with any obstacle"))
+			return 0, 0, 0, false
+		}
 
-		x, y, vx, vy = inp.advanceBall(dist, x, y, vx, vy)
-		tdist += math.Sqrt((ox-x)*(ox-x) + (oy-y)*(oy-y))
-		debug(" - advance: %+.3f %+.3f %+.3f %+.3f", x, y, vx, vy)
+		var d float64
+		x, y, vx, vy, d = inp.advanceBall(dist, x, y, vx, vy, k)
+		wandered += d
+		t += travelTime(d, v0, inp.friction())
+		if inp.check.on() {
+			inp.checkPosition(i, t, x, y, inp.Ball)
+		}
 		if inp.stopped(vx, vy) {
-			return x, y, true
+			inp.event("stop", 0, x, y, 0, 0, level, nil)
+			return x, y, level, true
+		}
+
+		if d > tol || obstacle == nil || mover != nil {
+			jam = 0
+		} else if jam++; jam > maxJam {
+			// stuck, e.g. in a wedge, which is not a proper stop
+			if inp.check.on() {
+				inp.check.report("jam", i, x, y, fmt.Sprintf("stuck against %v", describe(obstacle)))
+			}
+			inp.event("stop", 0, x, y, 0, 0, level, obstacle)
+			return x, y, level, false
+		}
+		if mover == nil && obstacle == nil {
+			// the direction wanders along the way, but only changes where
+			// it can not make the ball penetrate an obstacle
+			vx, vy = inp.wander(r, wandered, vx, vy)
+			wandered = 0
+			if dist == seam {
+				vx, vy = rotate(vx, vy, r.NormFloat64()*inp.Seams[si].Kick)
+			}
 		}
 
-		vx, vy = obstacle.Bounce(x, y, vx, vy, inp.Ball, inp.Elasticity)
-		debug(" - bounce:  %+.3f %+.3f %+.3f %+.3f", x, y, vx, vy)
+		switch {
+		case mover != nil:
+			vx, vy = mover.BounceAt(t, x, y, vx, vy, inp.Ball, inp.Elasticity)
+			inp.event("bounce", 0, x, y, vx, vy, level, mover)
+		case obstacle != nil:
+			v0x, v0y := vx, vy
+			vx, vy = obstacle.Bounce(x, y, vx, vy, inp.Ball, inp.Elasticity)
+			x, y = inp.separate(obstacle, x, y, inp.Ball)
+			if _, c := obstacle.(coated); inp.check.on() && !c && inp.Elasticity <= 1 {
+				inp.checkEnergy(i, x, y, v0x*v0x+v0y*v0y, vx*vx+vy*vy)
+			}
+			if curl != 0 {
+				vx, vy = leave(obstacle, x, y, vx, vy)
+			}
+			inp.event("bounce", 0, x, y, vx, vy, level, obstacle)
+		case dist == edge:
+			var dt float64
+			level, x, y, vx, vy, dt = inp.fallOff(r, all, level, x, y, vx, vy)
+			inp.Obstacles = inp.onLevel(all, level)
+			inp.Friction = friction * inp.roomFriction(x, y)
+			t += dt
+			inp.event("edge", 0, x, y, vx, vy, level, nil)
+			continue
+		case dist == door:
+			v := math.Sqrt(vx*vx + vy*vy)
+			inp.Friction = friction * inp.roomFriction(x+vx/v*edgeStep, y+vy/v*edgeStep)
+			inp.event("door", 0, x, y, vx, vy, level, nil)
+			continue
+		case dist == seam:
+			inp.event("seam", 0, x, y, vx, vy, level, nil)
+			continue
+		default:
+			// only a step along a curved path
+			inp.event("step", 0, x, y, vx, vy, level, nil)
+			continue
+		}
+		i++
 	}
 
 	inp.Error(errors.New("maxBounce reached - did you have a bad config?"))
-	return 0, 0, false
-}
-
-func (inp Input) stopped(vx, vy float64) bool {
-	return math.Sqrt(vx*vx+vy*vy) < inp.Terminal
+	return 0, 0, 0, false
 }
 
 func (inp Input) randInitial(r *rand.Rand) (float64, float64) {
 	return inp.Velocity(r)
 }
 
-func (inp Input) closesObstacle(x0, y0, vx, vy float64) (float64, Obstacle) {
+// closesObstacle returns the distance to the first obstacle hit, or +Inf and
+// a nil obstacle if there is none.
+func (inp Input) closesObstacle(x0, y0, vx, vy, r float64) (float64, Obstacle) {
+	if g := inp.indexed(r); g != nil {
+		return g.closest(x0, y0, vx, vy, r)
+	}
 	closest, closestID := math.MaxFloat64, -1
 	for i, o := range inp.Obstacles {
-		d, ok := o.DistToColl(x0, y0, vx, vy, inp.Ball)
+		d, ok := o.DistToColl(x0, y0, vx, vy, r)
 		if !ok {
 			continue
 		}
-		if d >= 0 && d < closest {
+		if d > -tol && d < closest {
 			closest = d
 			closestID = i
 		}
 	}
 	if closestID < 0 {
-		inp.Error(errors.New("did not collie with any obstacle"))
+		return math.Inf(1), nil
 	}
+	closest = math.Max(closest, 0)
 	return closest * math.Sqrt(vx*vx+vy*vy), inp.Obstacles[closestID]
 }
 
-func (inp Input) advanceBall(dist, x, y, vx, vy float64) (float64, float64, float64, float64) {
-	// Advance the ball accounting for fricition, either stoping before the obstacle or retaining some velocity
+// advanceBall moves the ball dist along its path, curving with k, accounting
+// for friction. It either stops before or retains some velocity, the
+// distance actually travelled is returned.
+func (inp Input) advanceBall(dist, x, y, vx, vy, k float64) (float64, float64, float64, float64, float64) {
+	return advance(dist, x, y, vx, vy, k, inp.friction(), inp.Terminal)
+}
+
+// advance is advanceBall for a ball with the given friction and terminal
+// speed.
+func advance(dist, x, y, vx, vy, k, friction, terminal float64) (float64, float64, float64, float64, float64) {
 	v := math.Sqrt(vx*vx + vy*vy)
 	n0, n1 := vx/v, vy/v
-	distToTerminal := (v + inp.Terminal) / 2 * (inp.Terminal - v) / inp.Friction
-	if distToTerminal > 0 && distToTerminal <= dist {
-		return x + n0*distToTerminal, y + n1*distToTerminal, 0, 0
+	distToTerminal := (v + terminal) / 2 * (terminal - v) / friction
+	stop := distToTerminal > 0 && distToTerminal <= dist
+	if stop {
+		dist = distToTerminal
+	}
+	if k != 0 {
+		sin, cos := math.Sincos(k * dist)
+		x, y = x+(n0*sin-n1*(1-cos))/k, y+(n1*sin+n0*(1-cos))/k
+		n0, n1 = n0*cos-n1*sin, n0*sin+n1*cos
+	} else {
+		x, y = x+n0*dist, y+n1*dist
+	}
+	if stop {
+		return x, y, 0, 0, dist
 	}
-	v = math.Sqrt(v*v + 2*dist*inp.Friction)
-	return x + dist*n0, y + dist*n1, n0 * v, n1 * v
+	v = math.Sqrt(v*v + 2*dist*friction)
+	return x, y, n0 * v, n1 * v, dist
 }
@@ -1,14 +1,27 @@
 package bounces
 
 import (
+	"errors"
 	img "image"
 	"image/color"
+	"image/draw"
 	"image/png"
 	"io"
 	"math"
+	"strconv"
+	"strings"
+
+	"github.com/vron/bounces/line"
+	"github.com/vron/bounces/shape"
 )
 
 func (r Results) Draw(w io.Writer, f func(a float64) float64) error {
+	return png.Encode(w, r.density(f))
+}
+
+// density returns the image of where the trajectories ended, darker where
+// f of the count is larger.
+func (r Results) density(f func(a float64) float64) *img.Gray {
 	res := int(math.Sqrt(float64(len(r.Image))))
 	img := img.NewGray(img.Rect(0, 0, res, res))
 
@@ -25,5 +38,222 @@ func (r Results) Draw(w io.Writer, f func(a float64) float64) error {
 			img.SetGray(xi, yi, color.Gray{math.MaxUint8 - uint8(val)})
 		}
 	}
-	return png.Encode(w, img)
+	return img
+}
+
+var (
+	obstacleColor = color.RGBA{0x40, 0x40, 0x40, 0xff}
+	levelColor    = color.RGBA{0xa0, 0xa0, 0xa0, 0xff}
+	pathColor     = color.RGBA{0xd0, 0x20, 0x20, 0xff}
+	noneColor     = color.RGBA{0x90, 0x90, 0x90, 0xff}
+
+	// the colors of the measures, by their order
+	measureColors = []color.RGBA{
+		{0xd0, 0x20, 0x20, 0xff}, {0x20, 0x40, 0xd0, 0xff}, {0x20, 0xa0, 0x20, 0xff}, {0xf0, 0x90, 0x00, 0xff},
+		{0x90, 0x20, 0xb0, 0xff}, {0x00, 0xb0, 0xc0, 0xff}, {0x80, 0x50, 0x20, 0xff}, {0xe0, 0x40, 0xc0, 0xff},
+	}
+	measureColorNames = []string{"red", "blue", "green", "orange", "purple", "cyan", "brown", "magenta"}
+)
+
+// A PathColor is how DrawPaths colors the paths.
+type PathColor int
+
+const (
+	// ByMeasure colors each path by the first measure it ended in, gray if
+	// none, see Legend.
+	ByMeasure PathColor = iota
+	// BySpeed colors the paths from blue where slow to red where fastest.
+	BySpeed
+)
+
+var pathColorNames = []string{"measure", "speed"}
+
+func (c PathColor) String() string {
+	if c < 0 || int(c) >= len(pathColorNames) {
+		return "PathColor(" + strconv.Itoa(int(c)) + ")"
+	}
+	return pathColorNames[c]
+}
+
+// ParsePathColor returns the path coloring named s.
+func ParsePathColor(s string) (PathColor, error) {
+	for c, n := range pathColorNames {
+		if n == strings.ToLower(s) {
+			return PathColor(c), nil
+		}
+	}
+	return 0, errors.New("unknown path coloring: '" + s + "'")
+}
+
+// Legend returns the name of each measure followed by the name of its color
+// when DrawPaths colors by measure.
+func (r Results) Legend() []string {
+	l := []string{}
+	for mi, n := range r.Names {
+		l = append(l, n+" "+measureColorNames[mi%len(measureColorNames)])
+	}
+	return append(l, "none gray")
+}
+
+// DrawPaths draws the paths, with the obstacles of the input, over the
+// density image as drawn by Draw, or beside it if beside is set.
+func (r Results) DrawPaths(w io.Writer, f func(a float64) float64, inp Input, paths []Path, by PathColor, beside bool) error {
+	d := r.density(f)
+	res := d.Rect.Dx()
+	c := canvas{bounds: r.Counts.Bounds, res: res}
+	if beside {
+		c.RGBA, c.x0 = img.NewRGBA(img.Rect(0, 0, 2*res, res)), res
+		draw.Draw(c, c.Rect, img.White, img.Point{}, draw.Src)
+	} else {
+		c.RGBA = img.NewRGBA(d.Rect)
+	}
+	draw.Draw(c, d.Rect, d, img.Point{}, draw.Src)
+	c.scene(inp)
+
+	fastest := 0.0
+	for _, p := range paths {
+		for _, e := range p.Events {
+			fastest = math.Max(fastest, math.Hypot(e.VX, e.VY))
+		}
+	}
+	for _, p := range paths {
+		col := color.Color(noneColor)
+	Measures:
+		for mi, n := range r.Names {
+			for _, in := range p.Measures {
+				if in == n {
+					col = measureColors[mi%len(measureColors)]
+					break Measures
+				}
+			}
+		}
+		c.path(p.Events, func(e Event) color.Color {
+			if by == ByMeasure {
+				return col
+			}
+			s := 0.0
+			if fastest > 0 {
+				s = math.Hypot(e.VX, e.VY) / fastest
+			}
+			return color.RGBA{uint8(0xff * s), 0x20, uint8(0xff * (1 - s)), 0xff}
+		})
+	}
+	return png.Encode(w, c)
+}
+
+// DrawEvents draws the obstacles of the input and the path of each ball
+// through the events, as an image of resolution res mapping the scene as
+// the density image does.
+func (inp Input) DrawEvents(w io.Writer, res int, events []Event) error {
+	c := inp.newCanvas(res)
+	c.scene(inp)
+	c.path(events, func(Event) color.Color {
+		return pathColor
+	})
+	return png.Encode(w, c)
+}
+
+// A canvas is a color image of the scene, with the same mapping from the
+// scene to pixels as the density image but shifted x0 pixels to the right.
+type canvas struct {
+	*img.RGBA
+	bounds  [4]float64
+	res, x0 int
+}
+
+func (inp Input) newCanvas(res int) canvas {
+	c := canvas{RGBA: img.NewRGBA(img.Rect(0, 0, res, res)), res: res}
+	c.bounds[0], c.bounds[1], c.bounds[2], c.bounds[3] = inp.bounds()
+	draw.Draw(c, c.Rect, img.White, img.Point{}, draw.Src)
+	return c
+}
+
+// point returns the position of (x, y) in pixels.
+func (c canvas) point(x, y float64) (float64, float64) {
+	m := math.Max(c.bounds[2], c.bounds[3])
+	res := float64(c.res)
+	return float64(c.x0) + (x-c.bounds[0])/m*res, (y - c.bounds[1]) / m * res
+}
+
+// line draws the line from (x0, y0) to (x1, y1).
+func (c canvas) line(x0, y0, x1, y1 float64, col color.Color) {
+	px0, py0 := c.point(x0, y0)
+	px1, py1 := c.point(x1, y1)
+	// lines far outside of the image are only drawn in part
+	n := math.Ceil(math.Max(math.Abs(px1-px0), math.Abs(py1-py0)))
+	n = math.Min(n, float64(4*c.res))
+	for s := 0.0; s <= n; s++ {
+		f := 0.0
+		if n > 0 {
+			f = s / n
+		}
+		c.Set(int(px0+f*(px1-px0)), int(py0+f*(py1-py0)), col)
+	}
+}
+
+// dot draws a dot of three by three pixels at (x, y).
+func (c canvas) dot(x, y float64, col color.Color) {
+	px, py := c.point(x, y)
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			c.Set(int(px)+dx, int(py)+dy, col)
+		}
+	}
+}
+
+// scene draws the edges of the levels and the obstacles, the moving ones
+// where they start.
+func (c canvas) scene(inp Input) {
+	for _, l := range inp.Levels {
+		for _, e := range l.edges() {
+			c.obstacle(e, levelColor)
+		}
+	}
+	for _, o := range inp.Obstacles {
+		c.obstacle(o, obstacleColor)
+	}
+	for _, m := range inp.Movers {
+		if m, ok := m.(moving); ok {
+			c.obstacle(m.at(m.motion.From), obstacleColor)
+		}
+	}
+}
+
+func (c canvas) obstacle(o Obstacle, col color.Color) {
+	switch o := o.(type) {
+	case line.Segment:
+		c.line(o[0], o[1], o[0]+o[2], o[1]+o[3], col)
+	case shape.Circle:
+		if o.R == 0 {
+			return
+		}
+		const n = 64
+		for i := 0; i < n; i++ {
+			s0, c0 := math.Sincos(2 * math.Pi * float64(i) / n)
+			s1, c1 := math.Sincos(2 * math.Pi * float64(i+1) / n)
+			c.line(o.X+o.R*c0, o.Y+o.R*s0, o.X+o.R*c1, o.Y+o.R*s1, col)
+		}
+	case coated:
+		c.obstacle(o.surface, col)
+	}
+}
+
+// path draws the path of each ball through the events, each part in the
+// color given for the event it starts at, and a dot where it ends.
+func (c canvas) path(events []Event, col func(e Event) color.Color) {
+	var last []*Event
+	for i, e := range events {
+		for len(last) <= e.Ball {
+			last = append(last, nil)
+		}
+		if p := last[e.Ball]; p != nil {
+			c.line(p.X, p.Y, e.X, e.Y, col(*p))
+		}
+		last[e.Ball] = &events[i]
+	}
+	for _, e := range last {
+		if e != nil {
+			c.dot(e.X, e.Y, col(*e))
+		}
+	}
 }
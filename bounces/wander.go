@@ -0,0 +1,78 @@
+package bounces
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/vron/bounces/line"
+)
+
+// maxWander is the largest standard deviation of the direction change, due
+// to Wander, accumulated over a single straight step.
+const maxWander = 0.05
+
+// wanderStep returns the longest straight step allowed by Wander, or +Inf.
+func (inp Input) wanderStep() float64 {
+	if inp.Wander <= 0 {
+		return math.Inf(1)
+	}
+	return maxWander * maxWander / inp.Wander
+}
+
+// wander rotates the direction of travel by a normal distributed angle with
+// the variance Wander per unit of the distance d travelled.
+func (inp Input) wander(r *rand.Rand, d, vx, vy float64) (float64, float64) {
+	if inp.Wander <= 0 || d <= 0 {
+		return vx, vy
+	}
+	return rotate(vx, vy, r.NormFloat64()*math.Sqrt(inp.Wander*d))
+}
+
+func rotate(vx, vy, theta float64) (float64, float64) {
+	sin, cos := math.Sincos(theta)
+	return vx*cos - vy*sin, vx*sin + vy*cos
+}
+
+// seam returns the distance along the path, curving with k, to the first
+// seam crossed, and its index, or +Inf and -1.
+func (inp Input) seam(x, y, vx, vy, k float64) (float64, int) {
+	if len(inp.Seams) == 0 {
+		return math.Inf(1), -1
+	}
+	segs := make([]line.Segment, len(inp.Seams))
+	for si, s := range inp.Seams {
+		segs[si] = s.Segment
+	}
+	return crossing(segs, x, y, vx, vy, k)
+}
+
+// A Seam is a line on the floor which, when crossed, changes the direction
+// of travel by a normal distributed angle with standard deviation Kick.
+type Seam struct {
+	line.Segment
+	Kick float64
+}
+
+type parseWander struct{}
+
+// Handle takes care of 'wander d', d being the variance of the direction in
+// rad² per unit of distance, as well as 'seam x0 y0 x1 y1 kick'.
+func (p parseWander) Handle(d []string, i *Input) bool {
+	switch d[0] {
+	case "wander":
+		if len(d) != 2 {
+			i.Error(errors.New(""), "wander expects 1 argument")
+		}
+		i.Wander = i.num(d[1])
+	case "seam":
+		if len(d) != 6 {
+			i.Error(errors.New(""), "seam expects 5 arguments")
+		}
+		s := line.SegmentFromPoints(i.num(d[1]), i.num(d[2]), i.num(d[3]), i.num(d[4]))
+		i.Seams = append(i.Seams, Seam{s, i.num(d[5])})
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package bounces
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// fieldScene is a box large enough for the ball, thrown along x, to stop
+// before reaching a wall.
+const fieldScene = `ball 0.02
+velocity uniform 1 1
+friction -0.5
+terminal 0.01
+elasticity 0.5
+start 2 10
+
+line 0 0 20 0
+line 20 0 20 20
+line 20 20 0 20
+line 0 20 0 0
+
+measure all 0 0 20 20
+`
+
+// thrown returns the paths of n balls thrown along x with the speed 2.
+func thrown(t *testing.T, scene string, n int) []Path {
+	inp := parseScene(t, scene)
+	inp.Velocity = func(r *rand.Rand) (float64, float64) {
+		return 2, 0
+	}
+	return inp.Paths(n)
+}
+
+func TestNoWander(t *testing.T) {
+	for _, p := range thrown(t, fieldScene, 10) {
+		for _, e := range p.Events {
+			if e.Y != 10 || e.VY != 0 || (e.Kind != "start" && e.Kind != "stop") {
+				t.Log("expected a straight path, got: ", e)
+				t.Error()
+			}
+		}
+	}
+}
+
+// TestWander checks that the variance of the direction grows as Wander per
+// unit of distance rolled.
+func TestWander(t *testing.T) {
+	ps := thrown(t, fieldScene+"wander 0.01\n", 2000)
+	sum, n := 0.0, 0
+	for _, p := range ps {
+		s := 0.0
+		for i := 1; i < len(p.Events); i++ {
+			e, prev := p.Events[i], p.Events[i-1]
+			s += math.Hypot(e.X-prev.X, e.Y-prev.Y)
+			if e.Kind == "step" {
+				a := math.Atan2(e.VY, e.VX)
+				sum += a * a / s
+				n++
+			}
+		}
+	}
+	w := sum / float64(n)
+	t.Log("expected:", 0.01, "got: ", w, "over", n, "steps")
+	if math.Abs(w-0.01) > 0.001 {
+		t.Error()
+	}
+}
+
+// TestSeam checks that the direction changes by about Kick where, and only
+// where, the ball crosses the seam.
+func TestSeam(t *testing.T) {
+	ps := thrown(t, fieldScene+"seam 3 0 3 20 0.1\n", 2000)
+	sum := 0.0
+	for _, p := range ps {
+		seams := 0
+		for _, e := range p.Events {
+			switch {
+			case e.Kind == "seam":
+				a := math.Atan2(e.VY, e.VX)
+				sum += a * a
+				seams++
+				if math.Abs(e.X-3) > 1e-9 || e.Y != 10 {
+					t.Log("expected the seam at", 3, 10, "got: ", e)
+					t.Error()
+				}
+			case seams == 0 && (e.Y != 10 || e.VY != 0):
+				t.Log("expected a straight path up to the seam, got: ", e)
+				t.Error()
+			}
+		}
+		if seams != 1 {
+			t.Log("expected:", 1, "got: ", seams, "seams crossed")
+			t.Error()
+		}
+	}
+	k := math.Sqrt(sum / float64(len(ps)))
+	t.Log("expected:", 0.1, "got: ", k)
+	if math.Abs(k-0.1) > 0.01 {
+		t.Error()
+	}
+}
@@ -2,6 +2,8 @@ package line
 
 import (
 	"math"
+
+	"github.com/vron/bounces/material"
 )
 
 // TODO: update this to use the offsets based on ball radius
@@ -30,56 +32,135 @@ func (s Segment) Bounds() (x, y, w, h float64) {
 	return
 }
 
-func (s Segment) DistToColl(x, y, vx, vy, r float64) (float64, bool) {
-	// we check this by checking to lintes offset (the one in correct dir), and using two circles at the ends.
-	d, n := s.distAndItem(x, y, vx, vy, r)
-	if n < 0 {
-		return -1, false
+// Moved returns the segment translated by (dx, dy) after being rotated by
+// theta around (cx, cy).
+func (s Segment) Moved(dx, dy, theta, cx, cy float64) Segment {
+	sin, cos := math.Sincos(theta)
+	x0, y0 := s[0]-cx, s[1]-cy
+	return Segment{
+		cx + cos*x0 - sin*y0 + dx,
+		cy + sin*x0 + cos*y0 + dy,
+		cos*s[2] - sin*s[3],
+		sin*s[2] + cos*s[3],
 	}
-	return d, true
 }
 
-func (s Segment) distAndItem(x, y, vx, vy, r float64) (float64, int) {
+// Closest returns the point on the segment closest to (x, y).
+func (s Segment) Closest(x, y float64) (float64, float64) {
+	t := ((x-s[0])*s[2] + (y-s[1])*s[3]) / (s[2]*s[2] + s[3]*s[3])
+	t = math.Max(0, math.Min(1, t))
+	return s[0] + t*s[2], s[1] + t*s[3]
+}
+
+// DistToColl returns when, in units of the velocity (vx, vy), a ball of
+// radius r at (x, y) touches the segment while approaching it. A ball that
+// already overlaps it while approaching touches it at 0. As the end points
+// are left to separate circles, only contacts along the segment count.
+func (s Segment) DistToColl(x, y, vx, vy, r float64) (float64, bool) {
 	l := math.Sqrt(s[2]*s[2] + s[3]*s[3])
 	nx, ny := -s[3]/l, s[2]/l
-	if nx*vx+ny*vy > 0 {
-		nx, ny = -nx, -ny
+	h := (x-s[0])*nx + (y-s[1])*ny
+	if r <= tol && math.Abs(h) <= tol {
+		// a point on the line can only just have bounced on it
+		return -1, false
 	}
-	d, ok := s.distToColl(x, y, vx, vy, nx*r, ny*r)
-	if ok {
-		return d, 0
+	if h < 0 {
+		nx, ny, h = -nx, -ny, -h
 	}
-	return -1, -1
-
-}
-
-func (s Segment) distToColl(x, y, vx, vy, ox, oy float64) (float64, bool) {
-	// see also http://geomalgorithms.com/a05-_intersect-1.html
-	u1, u2 := s[2], s[3]
-	v1, v2 := vx, vy
-	w1, w2 := ox+s[0]-x, oy+s[1]-y
-
-	d := (v1*u2 - v2*u1)
-	if math.Abs(d) < tol {
+	// grazing contacts, e.g. rolling along the segment, are not approaching
+	vn := nx*vx + ny*vy
+	if vn >= -tol*math.Sqrt(vx*vx+vy*vy) {
 		return -1, false
 	}
-
-	si := (v2*w1 - v1*w2) / d
+	t := math.Max(0, (h-r)/-vn)
+	si := ((x+vx*t-s[0])*s[2] + (y+vy*t-s[1])*s[3]) / (l * l)
 	if si < 0 || si > 1 {
 		return -1, false
 	}
+	return t, true
+}
+
+// ArcDistToColl returns the distance a ball of radius r travels along a
+// circular arc, starting at (x, y) in the direction (vx, vy) and curving
+// with the signed curvature k (positive turning left), before it hits the
+// segment. As for DistToColl the end points are not considered.
+func (s Segment) ArcDistToColl(x, y, vx, vy, k, r float64) (float64, bool) {
+	l := math.Sqrt(s[2]*s[2] + s[3]*s[3])
+	v := math.Sqrt(vx*vx + vy*vy)
+	dx, dy := s[2]/l, s[3]/l
+	nx, ny := -dy, dx
+	cx, cy := x-vy/v/k, y+vx/v/k
+	rho := 1 / math.Abs(k)
+
+	best := -1.0
+	for _, side := range [2]float64{1, -1} {
+		ox, oy := s[0]+side*r*nx, s[1]+side*r*ny
+		h := (cx-ox)*nx + (cy-oy)*ny
+		if math.Abs(h) > rho+tol {
+			continue
+		}
+		w := math.Sqrt(math.Max(0, rho*rho-h*h))
+		for _, sg := range [2]float64{1, -1} {
+			px, py := cx-h*nx+sg*w*dx, cy-h*ny+sg*w*dy
+			t := ((px-ox)*dx + (py-oy)*dy) / l
+			if t < 0 || t > 1 {
+				continue
+			}
+			// only count it if moving towards the segment, or if just
+			// touching it while curving towards it
+			tx, ty := -k*(py-cy), k*(px-cx)
+			if dot := (tx*nx + ty*ny) * side; dot > tol || (dot > -tol && h*side > 0) {
+				continue
+			}
+			if d := ArcLength(x, y, cx, cy, px, py, k); best < 0 || d < best {
+				best = d
+			}
+		}
+	}
+	return best, best >= 0
+}
 
-	ti := (u2*w1 - u1*w2) / d
-	return ti, true
+// ArcLength returns the distance from (x0, y0) to (x1, y1) along the circle
+// centered at (cx, cy) when moving with the signed curvature k.
+func ArcLength(x0, y0, cx, cy, x1, y1, k float64) float64 {
+	a := math.Atan2(y1-cy, x1-cx) - math.Atan2(y0-cy, x0-cx)
+	if k < 0 {
+		a = -a
+	}
+	a = math.Mod(a, 2*math.Pi)
+	if a < 0 {
+		a += 2 * math.Pi
+	}
+	return a / math.Abs(k)
 }
 
+// Bounce keeps the fraction el of the energy of the normal speed.
 func (s Segment) Bounce(x, y, vx, vy, r, el float64) (float64, float64) {
+	return s.bounce(vx, vy, el)
+}
+
+// BounceWith bounces with the coefficient of restitution given by e for the
+// normal impact speed, which being a ratio of speeds keeps its square of the
+// energy.
+func (s Segment) BounceWith(x, y, vx, vy, r float64, e material.Restitution) (float64, float64) {
+	nx, ny := s.normal()
+	c := e.At(math.Abs(nx*vx + ny*vy))
+	return s.bounce(vx, vy, c*c)
+}
+
+// normal returns the unit normal of the segment.
+func (s Segment) normal() (float64, float64) {
+	l := math.Sqrt(s[2]*s[2] + s[3]*s[3])
+	return -s[3] / l, s[2] / l
+}
+
+// bounce keeps the fraction el of the energy of the normal speed.
+func (s Segment) bounce(vx, vy, el float64) (float64, float64) {
 	// so we bounce against the line
 	// split velocity into (t, n) components, t velocity must be
 	// unchanged thanks to conservation of momentum
-	l := math.Sqrt(s[2]*s[2] + s[3]*s[3])
-	nx, ny := -s[3]/l, s[2]/l
-	tx, ty := s[2]/l, s[3]/l
+	nx, ny := s.normal()
+	tx, ty := ny, -nx
 
 	n, t := nx*vx+ny*vy, tx*vx+ty*vy
 	E := (n * n) * el
@@ -3,6 +3,8 @@ package line
 import (
 	"math"
 	"testing"
+
+	"github.com/vron/bounces/material"
 )
 
 func TestDistance(t *testing.T) {
@@ -24,6 +26,13 @@ func TestDistance(t *testing.T) {
 	distance(t, -1, false, 0.1,
 		0, 1, 1, 1,
 		0, 0, 1, -0.1)
+	// starting in contact, or touching and moving along
+	distance(t, 0, true, 0.1,
+		0, 1, 1, 1,
+		0.5, 0.95, 0, 1)
+	distance(t, -1, false, 0.1,
+		0, 1, 1, 1,
+		0.5, 0.9, 1, 0)
 }
 
 func TestBounce(t *testing.T) {
@@ -66,3 +75,111 @@ func bounce(t *testing.T, e, r float64, px, py, qx, qy, x, y, vx, vy, bx, by flo
 		t.Error()
 	}
 }
+
+func TestMoved(t *testing.T) {
+	moved(t, SegmentFromPoints(1, 0, 2, 0), 0, 0, math.Pi/2, 0, 0, SegmentFromPoints(0, 1, 0, 2))
+	moved(t, SegmentFromPoints(1, 0, 2, 0), 1, -1, 0, 0, 0, SegmentFromPoints(2, -1, 3, -1))
+	moved(t, SegmentFromPoints(0, 0, 2, 0), 0, 1, math.Pi, 1, 0, SegmentFromPoints(2, 1, 0, 1))
+}
+
+func moved(t *testing.T, s Segment, dx, dy, theta, cx, cy float64, e Segment) {
+	a := s.Moved(dx, dy, theta, cx, cy)
+
+	t.Log("expected:", e, "got: ", a)
+	for i := range a {
+		if math.Abs(a[i]-e[i]) > tol {
+			t.Error()
+		}
+	}
+}
+
+func TestClosest(t *testing.T) {
+	closest(t, SegmentFromPoints(0, 0, 2, 0), 1, 1, 1, 0)
+	closest(t, SegmentFromPoints(0, 0, 2, 0), -1, 1, 0, 0)
+	closest(t, SegmentFromPoints(0, 0, 2, 0), 3, -1, 2, 0)
+	closest(t, SegmentFromPoints(0, 0, 1, 1), 0, 1, 0.5, 0.5)
+}
+
+func closest(t *testing.T, s Segment, x, y, ex, ey float64) {
+	a, b := s.Closest(x, y)
+
+	t.Log("expected:", ex, ey, "got: ", a, b)
+	if math.Abs(a-ex) > tol || math.Abs(b-ey) > tol {
+		t.Error()
+	}
+}
+
+func TestArcDistance(t *testing.T) {
+	// a quarter circle of radius 1 turning right reaches x = 1
+	arcDistance(t, math.Pi/2, true, 0,
+		1, -5, 1, 5,
+		0, 0, 0, 1, -1)
+	arcDistance(t, math.Pi/2, true, 0,
+		-1, -5, -1, 5,
+		0, 0, 0, 1, 1)
+	arcDistance(t, math.Pi/3, true, 0,
+		0.5, -5, 0.5, 5,
+		0, 0, 0, 1, -1)
+	arcDistance(t, -1, false, 0,
+		2.5, -5, 2.5, 5,
+		0, 0, 0, 1, -1)
+	arcDistance(t, math.Pi/3, true, 0.5,
+		1, -5, 1, 5,
+		0, 0, 0, 1, -1)
+	arcDistance(t, 5*math.Pi/3, true, 0,
+		0.5, -5, 0.5, -0.1,
+		0, 0, 0, 1, -1)
+	// touching while curving into it or away from it
+	arcDistance(t, 0, true, 0.5,
+		0, -5, 0, 5,
+		0.5, 0, 0, 1, 1)
+	arcDistance(t, -1, false, 0.5,
+		0, -5, 0, 5,
+		0.5, 0, 0, 1, -0.1)
+}
+
+func arcDistance(t *testing.T, d float64, flag bool, r, px, py, qx, qy, x, y, vx, vy, k float64) {
+	s := SegmentFromPoints(px, py, qx, qy)
+
+	a, b := s.ArcDistToColl(x, y, vx, vy, k, r)
+
+	t.Log("expected:", flag, d, "got: ", b, a)
+	if b != flag || math.Abs(a-d) > tol {
+		t.Error()
+	}
+}
+
+func TestBounceWith(t *testing.T) {
+	bounceWith(t, material.Constant(0.5), 0.1,
+		0, 0, 0, 1,
+		0.1, 0.5, -2, 1,
+		1, 1)
+	bounceWith(t, material.PowerLaw{E: 0.5, V: 1, P: 1}, 0.1,
+		0, 0, 0, 1,
+		0.1, 0.5, -2, 1,
+		0.5, 1)
+	bounceWith(t, material.Table{V: []float64{1, 3}, E: []float64{1, 0}}, 0.1,
+		0, 0, 0, 1,
+		0.1, 0.5, -2, 1,
+		1, 1)
+
+	// a restitution keeps its square of the energy, as an elasticity
+	s := SegmentFromPoints(0, 0, 0, 1)
+	a, b := s.Bounce(0.1, 0.5, -2, 1, 0.1, 0.25)
+	c, d := s.BounceWith(0.1, 0.5, -2, 1, 0.1, material.Constant(0.5))
+	t.Log("expected:", a, b, "got: ", c, d)
+	if math.Abs(a-c) > tol || math.Abs(b-d) > tol {
+		t.Error()
+	}
+}
+
+func bounceWith(t *testing.T, e material.Restitution, r, px, py, qx, qy, x, y, vx, vy, bx, by float64) {
+	s := SegmentFromPoints(px, py, qx, qy)
+
+	a, b := s.BounceWith(x, y, vx, vy, r, e)
+
+	t.Log("expected:", bx, by, "got: ", a, b)
+	if math.Abs(a-bx) > tol || math.Abs(b-by) > tol {
+		t.Error()
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -10,8 +11,10 @@ import (
 	"log"
 	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/vron/bounces/bounces"
 )
@@ -23,24 +26,85 @@ var (
 	fOutput     string
 	fRes        int
 	fLog        bool
+	fCheck      bool
+	fBatch      bool
+	fReplicates int
+	fConfidence float64
+	fInterval   string
+	fTimeout    time.Duration
+	fCheckpoint time.Duration
+	fResume     bool
+	fCounts     bool
+	fListen     string
+	fBlockTime  time.Duration
+	fWorkers    int
+	fSeed       int64
+	fLogMeasure string
+	fJSON       bool
+	fPaths      int
+	fPathColor  string
+	fBeside     bool
+
+	// pathColor is fPathColor parsed
+	pathColor bounces.PathColor
 )
 
 func init() {
 	flag.Int64Var(&fMaxIts, "max", 1e9, "maximum number of its")
 	flag.Int64Var(&fMinIts, "min", 1e4, "minimum number of its")
 	flag.IntVar(&fRes, "res", 1024, "image resolution")
-	flag.Float64Var(&fTargetPrec, "p", 1e-3, "approx target precision")
+	flag.Float64Var(&fTargetPrec, "p", 1e-3, "target half width of the confidence intervals, not the standard error, i.e. about twice it at 95%")
 	flag.StringVar(&fOutput, "o", "./", "folder in which to save images")
 	flag.BoolVar(&fLog, "log", true, "plot in logarithmic space")
+	flag.BoolVar(&fCheck, "check", false, "check physical invariants along every trajectory")
+	flag.BoolVar(&fBatch, "batch", false, "simulate batches of balls together where the scene allows it")
+	flag.IntVar(&fReplicates, "replicates", 5, "number of independent replicates")
+	flag.Float64Var(&fConfidence, "confidence", 0.95, "confidence level of the intervals")
+	flag.StringVar(&fInterval, "interval", "batch-means", "interval method: batch-means, wilson or clopper-pearson")
+	flag.DurationVar(&fTimeout, "timeout", 0, "stop each run after this long, keeping the partial results")
+	flag.DurationVar(&fCheckpoint, "checkpoint", 0, "save the state of each run this often, and when it stops, next to the images")
+	flag.BoolVar(&fResume, "resume", false, "continue each run from its checkpoint, if there is one")
+	flag.BoolVar(&fCounts, "counts", false, "save the counts of each run next to its image, for merging")
+	flag.StringVar(&fListen, "listen", "", "coordinate workers connecting to this tcp:host:port or unix:path address")
+	flag.DurationVar(&fBlockTime, "block-timeout", 0, "hand a block to another worker if one takes longer than this, 10m if 0")
+	flag.IntVar(&fWorkers, "workers", 0, "number of blocks simulated in parallel, all cpus if 0")
+	flag.Int64Var(&fSeed, "seed", 0, "seed of the random numbers, runs with different seeds are independent")
+	flag.StringVar(&fLogMeasure, "log-measure", "", "list the trajectories ending in this measure, to replay them")
+	flag.BoolVar(&fJSON, "json", false, "print the events of a replayed trajectory as JSON")
+	flag.IntVar(&fPaths, "paths", 0, "draw the paths of this many trajectories over the image of each run")
+	flag.StringVar(&fPathColor, "paths-color", "measure", "color the paths by: measure or speed")
+	flag.BoolVar(&fBeside, "paths-beside", false, "draw the paths beside rather than over the image")
 }
 
 func main() {
 	flag.Parse()
 	normalizeArgs()
+	ctx := interruptible()
+
+	switch flag.Arg(0) {
+	case "merge":
+		merge(flag.Args()[1:])
+		return
+	case "worker":
+		work(flag.Arg(1))
+		return
+	case "replay":
+		if flag.NArg() != 3 {
+			log.Fatalln("replay expects a scene and a trajectory as seed:index")
+		}
+		replay(flag.Arg(1), flag.Arg(2))
+		return
+	}
+	if fListen != "" {
+		defer listen(fListen).Close()
+	}
 
 	// run all the provided files
 	for _, p := range flag.Args() {
-		runFile(p)
+		if ctx.Err() != nil {
+			break
+		}
+		runFile(ctx, p)
 	}
 
 	// also run from stdin if no input
@@ -48,11 +112,27 @@ func main() {
 		buf, err := ioutil.ReadAll(os.Stdin)
 		fatal(err)
 		if len(buf) > 0 {
-			runInput("stdin", bytes.NewBuffer(buf))
+			runInput(ctx, "stdin", bytes.NewBuffer(buf))
 		}
 	}
 }
 
+// interruptible returns a context cancelled on the first interrupt, letting
+// the current run finish its blocks and write its results. A second
+// interrupt kills the process.
+func interruptible() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		signal.Stop(sig)
+		log.Println("interrupted, finishing the current blocks")
+		cancel()
+	}()
+	return ctx
+}
+
 func normalizeArgs() {
 	if fMinIts < 1 {
 		fMinIts = 1
@@ -63,9 +143,12 @@ func normalizeArgs() {
 	if fTargetPrec < 0 {
 		fTargetPrec = 0
 	}
+	var err error
+	pathColor, err = bounces.ParsePathColor(fPathColor)
+	fatal(err, "-paths-color:")
 }
 
-func runFile(p string) {
+func runFile(ctx context.Context, p string) {
 	file := filepath.Base(p)
 	name := strings.TrimSuffix(file, filepath.Ext(file))
 
@@ -73,18 +156,99 @@ func runFile(p string) {
 	fatal(err, "error opening input file:")
 	defer f.Close()
 
-	runInput(name, f)
+	runInput(ctx, name, f)
 }
 
-func runInput(name string, r io.Reader) {
-	input := bounces.ParseInput(r, fatal)
+func runInput(ctx context.Context, name string, r io.Reader) {
+	scene, err := ioutil.ReadAll(r)
+	fatal(err, "error reading input:")
+	input := bounces.ParseInput(bytes.NewReader(scene), fatal)
 	input.ImageRes = fRes
 	input.ImagePath = filepath.Join(fOutput, name+".p")
+	input.Check = fCheck
+	input.Batch = fBatch
+	input.Workers = fWorkers
+	input.Seed = fSeed
+	input.BlockTimeout = fBlockTime
+	input.LogMeasure = fLogMeasure
+	input.Replicates = fReplicates
+	input.Confidence = fConfidence
+	input.Interval, err = bounces.ParseInterval(fInterval)
+	fatal(err)
+	if fCheckpoint > 0 || fResume {
+		input.Checkpoint = filepath.Join(fOutput, name+".checkpoint")
+		input.CheckpointEvery = fCheckpoint
+		input.Resume = fResume
+	}
 	fmt.Printf("%20v ", name)
-	res := bounces.Run(input, fTargetPrec, fMinIts, fMaxIts)
-	fmt.Printf("%12v\t%.4g%%\t±%.4g\n", input.Measures[0].Name, 100*res.Measures[0], 100*res.MeasureErrors[0])
-	for mi := range res.Measures[1:] {
-		fmt.Printf("%20v %12v\t%.4g%%\t±%.4g\n", name, input.Measures[mi+1].Name, 100*res.Measures[mi+1], 100*res.MeasureErrors[mi+1])
+	if fTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fTimeout)
+		defer cancel()
+	}
+	var res bounces.Results
+	if conns != nil {
+		res = bounces.Coordinate(ctx, conns, scene, input, fTargetPrec, fMinIts, fMaxIts)
+	} else {
+		res = bounces.RunContext(ctx, input, fTargetPrec, fMinIts, fMaxIts)
+	}
+	report(name, res)
+	if res.Partial {
+		fmt.Printf("%20v %12v\tstopped after %v trajectories: %v\n", name, "PARTIAL", res.Samples, ctx.Err())
+	}
+	write(name, res, fCounts)
+	if fPaths > 0 {
+		writePaths(name, input, res)
+	}
+}
+
+// report prints the measures of the results.
+func report(name string, res bounces.Results) {
+	for mi := range res.Measures {
+		if mi > 0 {
+			fmt.Printf("%20v ", name)
+		}
+		note := ""
+		if res.ReportOnly[mi] {
+			note = "\treport only"
+		}
+		fmt.Printf("%12v\t%.4g%%\t±%.4g\t[%.4g%%, %.4g%%]%v\n", res.Names[mi], 100*res.Measures[mi], 100*res.MeasureErrors[mi], 100*res.Lower[mi], 100*res.Upper[mi], note)
+	}
+	if l := res.Limiting; l >= 0 {
+		state := "reached"
+		if !res.Converged {
+			state = "not reached"
+		}
+		fmt.Printf("%20v %12v\t%v ±%.4g of ±%.4g, target %v\n", name, "limiting", res.Names[l], 100*res.MeasureErrors[l], 100*res.Targets[l], state)
+	}
+	fmt.Printf("%20v %12v\t%v%% %v over %v replicates of %v trajectories\n", name, "interval", 100*res.Confidence, res.Interval, res.Replicates, res.Samples)
+	fmt.Printf("%20v %12v\t%v\n", name, "seed", strings.Trim(fmt.Sprint(res.Counts.Seeds), "[]"))
+	if res.Jammed > 0 {
+		fmt.Printf("%20v %12v\t%v trajectories got stuck and are not counted\n", name, "jammed", res.Jammed)
+	}
+	if fCheck {
+		fmt.Printf("%20v %12v\t%v\n", name, "violations", res.ViolationCount)
+		for _, v := range res.Violations {
+			fmt.Printf("%20v %12v\t%v\n", name, "", v)
+		}
+	}
+	if res.LoggedCount > 0 || fLogMeasure != "" {
+		fmt.Printf("%20v %12v\t%v trajectories, the first %v being\n", name, "logged", res.LoggedCount, len(res.Logged))
+		for _, t := range res.Logged {
+			fmt.Printf("%20v %12v\t%v\n", name, "", t)
+		}
+	}
+}
+
+// write saves the image, and if counts is set the counts, of the results.
+func write(name string, res bounces.Results, counts bool) {
+	if counts {
+		f, err := os.Create(filepath.Join(fOutput, name+".counts"))
+		fatal(err)
+		buf := bufio.NewWriter(f)
+		fatal(res.Counts.Write(buf))
+		fatal(buf.Flush())
+		fatal(f.Close())
 	}
 
 	// Write the image we might want to look at
@@ -103,6 +267,24 @@ func runInput(name string, r io.Reader) {
 	fatal(res.Draw(buf, pl))
 }
 
+// writePaths saves the image of the results with a sample of fPaths
+// trajectories drawn over or beside it.
+func writePaths(name string, input bounces.Input, res bounces.Results) {
+	if pathColor == bounces.ByMeasure {
+		fmt.Printf("%20v %12v\t%v\n", name, "paths", strings.Join(res.Legend(), ", "))
+	}
+	f, err := os.Create(filepath.Join(fOutput, name+".paths.png"))
+	fatal(err)
+	buf := bufio.NewWriter(f)
+	pl := math.Log1p
+	if !fLog {
+		pl = func(a float64) float64 { return a }
+	}
+	fatal(res.DrawPaths(buf, pl, input, input.Paths(fPaths), pathColor, fBeside))
+	fatal(buf.Flush())
+	fatal(f.Close())
+}
+
 func fatal(e error, s ...interface{}) {
 	if e != nil {
 		str := fmt.Sprint(s...)
@@ -0,0 +1,49 @@
+// Package material describes how surfaces respond to impacts.
+package material
+
+import (
+	"math"
+	"sort"
+)
+
+// A Restitution gives the coefficient of restitution, the ratio of the normal
+// speeds after and before an impact, as a function of the normal impact
+// speed v.
+type Restitution interface {
+	At(v float64) float64
+}
+
+// Constant is a coefficient of restitution independent of the speed.
+type Constant float64
+
+func (c Constant) At(v float64) float64 {
+	return float64(c)
+}
+
+// PowerLaw gives E*(v/V)^-P, limited to at most 1, such that slow impacts
+// are more elastic than fast ones for a positive P.
+type PowerLaw struct {
+	E, V, P float64
+}
+
+func (p PowerLaw) At(v float64) float64 {
+	return math.Min(1, p.E*math.Pow(v/p.V, -p.P))
+}
+
+// Table interpolates linearly between the coefficients E at the increasing
+// speeds V, being constant outside of them.
+type Table struct {
+	V, E []float64
+}
+
+func (t Table) At(v float64) float64 {
+	i := sort.SearchFloat64s(t.V, v)
+	switch i {
+	case 0:
+		return t.E[0]
+	case len(t.V):
+		return t.E[len(t.E)-1]
+	}
+	f := (v - t.V[i-1]) / (t.V[i] - t.V[i-1])
+	return t.E[i-1] + f*(t.E[i]-t.E[i-1])
+}
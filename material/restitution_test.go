@@ -0,0 +1,39 @@
+package material
+
+import (
+	"math"
+	"testing"
+)
+
+const tol = 1e-8
+
+func TestConstant(t *testing.T) {
+	restitution(t, Constant(0.5), 0, 0.5)
+	restitution(t, Constant(0.5), 10, 0.5)
+}
+
+func TestPowerLaw(t *testing.T) {
+	p := PowerLaw{E: 0.8, V: 1, P: 0.5}
+	restitution(t, p, 1, 0.8)
+	restitution(t, p, 4, 0.4)
+	restitution(t, p, 0.25, 1)
+	restitution(t, p, 0, 1)
+}
+
+func TestTable(t *testing.T) {
+	tb := Table{V: []float64{1, 2, 4}, E: []float64{0.9, 0.7, 0.3}}
+	restitution(t, tb, 0.5, 0.9)
+	restitution(t, tb, 1, 0.9)
+	restitution(t, tb, 1.5, 0.8)
+	restitution(t, tb, 3, 0.5)
+	restitution(t, tb, 4, 0.3)
+	restitution(t, tb, 8, 0.3)
+}
+
+func restitution(t *testing.T, r Restitution, v, e float64) {
+	got := r.At(v)
+	t.Log("expected:", e, "got: ", got)
+	if math.Abs(got-e) > tol {
+		t.Error()
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/vron/bounces/bounces"
+)
+
+// merge adds the counts saved by several runs, e.g. with different seeds on
+// different machines, reporting and saving the results as a run named
+// merged.
+func merge(paths []string) {
+	cs := []bounces.Counts{}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		fatal(err, "error opening counts file:")
+		c, err := bounces.ReadCounts(bufio.NewReader(f))
+		fatal(err, "error reading "+p+":")
+		f.Close()
+		cs = append(cs, c)
+	}
+	m, err := bounces.MergeCounts(cs...)
+	fatal(err, "error merging:")
+	iv, err := bounces.ParseInterval(fInterval)
+	fatal(err)
+
+	res := m.Results(iv, fConfidence, fTargetPrec)
+	fmt.Printf("%20v ", "merged")
+	report("merged", res)
+	write("merged", res, true)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vron/bounces/bounces"
+)
+
+// conns receives the workers connecting if running as a coordinator.
+var conns chan net.Conn
+
+// address splits a tcp:host:port or unix:path address, a plain host:port
+// being tcp.
+func address(a string) (string, string) {
+	for _, n := range []string{"tcp", "unix"} {
+		if strings.HasPrefix(a, n+":") {
+			return n, strings.TrimPrefix(a, n+":")
+		}
+	}
+	return "tcp", a
+}
+
+// listen accepts workers on the address, to be handed to the runs.
+func listen(a string) net.Listener {
+	ln, err := net.Listen(address(a))
+	fatal(err, "error listening:")
+	conns = make(chan net.Conn)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- c
+		}
+	}()
+	return ln
+}
+
+// work connects to the coordinator at the address once per worker, and
+// again for every run, until it can no longer be reached.
+func work(a string) {
+	n := fWorkers
+	if n < 1 {
+		n = runtime.NumCPU()
+	}
+	wg := sync.WaitGroup{}
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				c, err := net.Dial(address(a))
+				if err != nil {
+					return
+				}
+				if err := bounces.Work(c, fatal); err == bounces.ErrProtocol {
+					log.Println("error working:", err)
+					return
+				} else if err != nil {
+					log.Println("error working:", err)
+					time.Sleep(time.Second)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vron/bounces/bounces"
+)
+
+// replay simulates the trajectory id, as logged by a run of the scene in p,
+// again. Its events are printed, as JSON if fJSON is set, and the path is
+// drawn next to the images of the runs.
+func replay(p, id string) {
+	t, err := bounces.ParseTrajectory(id)
+	fatal(err)
+	f, err := os.Open(p)
+	fatal(err, "error opening input file:")
+	input := bounces.ParseInput(bufio.NewReader(f), fatal)
+	f.Close()
+	events, in := input.Replay(t)
+
+	if fJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		fatal(enc.Encode(struct {
+			Trajectory bounces.Trajectory
+			Measures   []string
+			Events     []bounces.Event
+		}{t, in, events}))
+	} else {
+		for i, e := range events {
+			fmt.Printf("%4v %v\n", i, e)
+		}
+		fmt.Printf("ended in: %v\n", strings.Join(in, ", "))
+	}
+
+	file := filepath.Base(p)
+	name := strings.TrimSuffix(file, filepath.Ext(file))
+	out, err := os.Create(filepath.Join(fOutput, name+".replay-"+strings.Replace(t.String(), ":", "-", 1)+".png"))
+	fatal(err)
+	buf := bufio.NewWriter(out)
+	fatal(input.DrawEvents(buf, fRes, events))
+	fatal(buf.Flush())
+	fatal(out.Close())
+}
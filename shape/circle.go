@@ -1,6 +1,11 @@
 package shape
 
-import "math"
+import (
+	"math"
+
+	"github.com/vron/bounces/line"
+	"github.com/vron/bounces/material"
+)
 
 const tol = 1e-8
 
@@ -17,33 +22,106 @@ func (s Circle) Bounds() (x, y, w, h float64) {
 	return s.X - s.R, s.Y - s.R, 2 * s.R, 2 * s.R
 }
 
+// Moved returns the circle translated by (dx, dy) after being rotated by
+// theta around (cx, cy).
+func (s Circle) Moved(dx, dy, theta, cx, cy float64) Circle {
+	sin, cos := math.Sincos(theta)
+	x0, y0 := s.X-cx, s.Y-cy
+	return Circle{cx + cos*x0 - sin*y0 + dx, cy + sin*x0 + cos*y0 + dy, s.R}
+}
+
+// Closest returns the point on the circle closest to (x, y).
+func (s Circle) Closest(x, y float64) (float64, float64) {
+	dx, dy := x-s.X, y-s.Y
+	l := math.Sqrt(dx*dx + dy*dy)
+	if l == 0 {
+		return s.X + s.R, s.Y
+	}
+	return s.X + dx/l*s.R, s.Y + dy/l*s.R
+}
+
+// DistToColl returns when, in units of the velocity (vx, vy), a ball of
+// radius r at (x, y) touches the circle while approaching it. A ball that
+// already overlaps it while approaching touches it at 0.
 func (s Circle) DistToColl(x, y, vx, vy, r float64) (float64, bool) {
 	// https://stackoverflow.com/questions/1073336/circle-line-segment-collision-detection-algorithm
 	a := vx*vx + vy*vy
 	fx, fy := x-s.X, y-s.Y
 	b := 2 * (fx*vx + fy*vy)
 	c := fx*fx + fy*fy - (r+s.R)*(r+s.R)
+	if b >= -2*tol*math.Sqrt(a*(fx*fx+fy*fy)) || r+s.R <= tol {
+		return -1, false // moving away, or grazing
+	}
+	if c <= 0 {
+		return 0, true // in contact
+	}
 
 	d := b*b - 4*a*c
 	if d <= 0 {
 		return -1, false // no intersection
 	}
-	d = math.Sqrt(d)
-	t1 := (-b - d) / (2 * a)
-	t2 := (-b + d) / (2 * a)
-	_ = t2
-	if t1 > 0 {
-		return t1, true
+	// the smaller root, in a form without cancellation
+	return 2 * c / (-b + math.Sqrt(d)), true
+}
+
+// ArcDistToColl returns the distance a ball of radius r travels along a
+// circular arc, starting at (x, y) in the direction (vx, vy) and curving
+// with the signed curvature k (positive turning left), before it hits the
+// circle.
+func (s Circle) ArcDistToColl(x, y, vx, vy, k, r float64) (float64, bool) {
+	v := math.Sqrt(vx*vx + vy*vy)
+	cx, cy := x-vy/v/k, y+vx/v/k
+	rho, R := 1/math.Abs(k), s.R+r
+
+	dx, dy := s.X-cx, s.Y-cy
+	d := math.Sqrt(dx*dx + dy*dy)
+	if d == 0 || d > rho+R+tol || d < math.Abs(rho-R)-tol {
+		return -1, false
+	}
+	a := math.Acos(math.Max(-1, math.Min(1, (rho*rho+d*d-R*R)/(2*rho*d))))
+	base := math.Atan2(dy, dx)
+
+	best := -1.0
+	for _, phi := range [2]float64{base + a, base - a} {
+		px, py := cx+rho*math.Cos(phi), cy+rho*math.Sin(phi)
+		// only count it if moving into the circle, or if just touching it
+		// while curving into it
+		tx, ty := -k*(py-cy), k*(px-cx)
+		if dot := (tx*(px-s.X) + ty*(py-s.Y)) / R; dot > tol || (dot > -tol && (rho >= R || d >= R)) {
+			continue
+		}
+		if l := line.ArcLength(x, y, cx, cy, px, py, k); best < 0 || l < best {
+			best = l
+		}
 	}
-	return -1, false
+	return best, best >= 0
 }
 
+// Bounce keeps the fraction el of the energy of the normal speed.
 func (s Circle) Bounce(x, y, vx, vy, r, el float64) (float64, float64) {
-	px, py := x, y
+	return s.bounce(x, y, vx, vy, el)
+}
+
+// BounceWith bounces with the coefficient of restitution given by e for the
+// normal impact speed, which being a ratio of speeds keeps its square of the
+// energy.
+func (s Circle) BounceWith(x, y, vx, vy, r float64, e material.Restitution) (float64, float64) {
+	nx, ny := s.normal(x, y)
+	c := e.At(math.Abs(nx*vx + ny*vy))
+	return s.bounce(x, y, vx, vy, c*c)
+}
+
+// normal returns the unit normal of the circle at (x, y).
+func (s Circle) normal(x, y float64) (float64, float64) {
+	l := math.Hypot(x-s.X, y-s.Y)
+	return (x - s.X) / l, (y - s.Y) / l
+}
 
+// bounce keeps the fraction el of the energy of the normal speed.
+func (s Circle) bounce(x, y, vx, vy, el float64) (float64, float64) {
 	// split velocity into (t, n) components, t velocity must be
 	// unchanged thanks to conservation of momentum
-	nx, ny := (px-s.X)/(r+s.R), (py-s.Y)/(r+s.R)
+	nx, ny := s.normal(x, y)
 	tx, ty := ny, -nx
 
 	n, t := nx*vx+ny*vy, tx*vx+ty*vy
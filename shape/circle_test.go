@@ -3,6 +3,8 @@ package shape
 import (
 	"math"
 	"testing"
+
+	"github.com/vron/bounces/material"
 )
 
 const n = 1 / math.Sqrt2
@@ -17,9 +19,13 @@ func TestDistance(t *testing.T) {
 	distance(t, -1, false,
 		1, 1, 0.1,
 		0.1, 0, 0, -n, -n)
-	distance(t, -1, false,
+	// starting in contact
+	distance(t, 0, true,
 		1, 1, 0.1,
 		0.1, 0.95, 0.95, n, n)
+	distance(t, -1, false,
+		1, 1, 0.1,
+		0.1, 0.95, 0.95, -n, -n)
 }
 
 func TestBounce(t *testing.T) {
@@ -74,3 +80,94 @@ func bounce(t *testing.T, e float64, px, py, r, R, x, y, vx, vy, bx, by float64)
 		t.Error()
 	}
 }
+
+func TestMoved(t *testing.T) {
+	moved(t, NewCircle(1, 0, 0.1), 0, 0, math.Pi/2, 0, 0, NewCircle(0, 1, 0.1))
+	moved(t, NewCircle(1, 0, 0.1), 1, -1, math.Pi, 1, 0, NewCircle(2, -1, 0.1))
+}
+
+func moved(t *testing.T, s Circle, dx, dy, theta, cx, cy float64, e Circle) {
+	a := s.Moved(dx, dy, theta, cx, cy)
+
+	t.Log("expected:", e, "got: ", a)
+	if math.Abs(a.X-e.X) > tol || math.Abs(a.Y-e.Y) > tol || a.R != e.R {
+		t.Error()
+	}
+}
+
+func TestClosest(t *testing.T) {
+	closest(t, NewCircle(1, 1, 0.5), 3, 1, 1.5, 1)
+	closest(t, NewCircle(1, 1, 0.5), 1, 1.2, 1, 1.5)
+	closest(t, NewCircle(1, 1, 1), 0, 0, 1-n, 1-n)
+	closest(t, NewCircle(1, 1, 0), 0, 0, 1, 1)
+}
+
+func closest(t *testing.T, s Circle, x, y, ex, ey float64) {
+	a, b := s.Closest(x, y)
+
+	t.Log("expected:", ex, ey, "got: ", a, b)
+	if math.Abs(a-ex) > tol || math.Abs(b-ey) > tol {
+		t.Error()
+	}
+}
+
+func TestArcDistance(t *testing.T) {
+	// turning around (1, 0) with radius 1
+	a := math.Pi/2 - math.Acos(0.875)
+	arcDistance(t, a, true,
+		1, 1, 0.5,
+		0, 0, 0, 0, 1, -1)
+	arcDistance(t, -1, false,
+		1, 1, 0.5,
+		0, 0, 0, 0, 1, 1)
+	arcDistance(t, a, true,
+		1, 1, 0,
+		0.5, 0, 0, 0, 1, -1)
+	arcDistance(t, math.Pi+a, true,
+		1, 1, 0.5,
+		0, 0, 0, 0, -1, 1)
+	// touching the circle while curving into it or away from it
+	arcDistance(t, 0, true,
+		0, 0, 2,
+		0.5, 2.5, 0, 0, 1, 1)
+	arcDistance(t, -1, false,
+		0, 0, 2,
+		0.5, 2.5, 0, 0, 1, -1)
+}
+
+func arcDistance(t *testing.T, d float64, flag bool, px, py, r, R, x, y, vx, vy, k float64) {
+	s := NewCircle(px, py, r)
+
+	a, b := s.ArcDistToColl(x, y, vx, vy, k, R)
+
+	t.Log("expected:", flag, d, "got: ", b, a)
+	if b != flag || math.Abs(a-d) > 1e-6 {
+		t.Error()
+	}
+}
+
+func TestBounceWith(t *testing.T) {
+	bounceWith(t, material.Constant(0.5),
+		0, 0, 1, 0.1,
+		1.1, 0, -2, 1,
+		1, 1)
+	bounceWith(t, material.PowerLaw{E: 0.5, V: 1, P: 1},
+		0, 0, 1, 0.1,
+		1.1, 0, -2, 1,
+		0.5, 1)
+	bounceWith(t, material.Table{V: []float64{1, 3}, E: []float64{1, 0}},
+		0, 0, 1, 0.1,
+		1.1, 0, -2, 1,
+		1, 1)
+}
+
+func bounceWith(t *testing.T, e material.Restitution, px, py, r, R, x, y, vx, vy, bx, by float64) {
+	s := NewCircle(px, py, r)
+
+	a, b := s.BounceWith(x, y, vx, vy, R, e)
+
+	t.Log("expected:", bx, by, "got: ", a, b)
+	if math.Abs(a-bx) > tol || math.Abs(b-by) > tol {
+		t.Error()
+	}
+}